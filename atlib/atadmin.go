@@ -0,0 +1,85 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+)
+
+// The com.atproto.admin methods are authenticated with the admin token of the PDS,
+// the agent must be set up with SetAdminToken. They are not retried with a session refresh
+
+// GetAccountInfos returns the accounts of the DIDs known by the PDS, the unknown ones are left out
+func (c *BskyAgent) GetAccountInfos(ctx context.Context, dids []string) ([]*atproto.AdminDefs_AccountView, error) {
+	response, err := atproto.AdminGetAccountInfos(ctx, c.client, dids)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get account infos, %w", err)
+	}
+	return response.Infos, nil
+}
+
+// GetAccountInfo returns the account of the DID with its email and invite codes
+func (c *BskyAgent) GetAccountInfo(ctx context.Context, did string) (*atproto.AdminDefs_AccountView, error) {
+	response, err := atproto.AdminGetAccountInfo(ctx, c.client, did)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get account info, %w", err)
+	}
+	return response, nil
+}
+
+// GetAccountStatus returns the takedown and deactivated state of the account of the DID
+func (c *BskyAgent) GetAccountStatus(ctx context.Context, did string) (*atproto.AdminGetSubjectStatus_Output, error) {
+	response, err := atproto.AdminGetSubjectStatus(ctx, c.client, "", did, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get account status, %w", err)
+	}
+	return response, nil
+}
+
+// UpdateAccountStatus applies or reverts a takedown or a deactivation of the account of the DID,
+// a nil attribute is left as it is. ref is an optional reference of the moderation action
+func (c *BskyAgent) UpdateAccountStatus(ctx context.Context, did string, takedown, deactivated *bool, ref *string) error {
+	input := &atproto.AdminUpdateSubjectStatus_Input{
+		Subject: &atproto.AdminUpdateSubjectStatus_Input_Subject{
+			AdminDefs_RepoRef: &atproto.AdminDefs_RepoRef{
+				LexiconTypeID: "com.atproto.admin.defs#repoRef",
+				Did:           did,
+			},
+		},
+	}
+	if takedown != nil {
+		input.Takedown = &atproto.AdminDefs_StatusAttr{Applied: *takedown, Ref: ref}
+	}
+	if deactivated != nil {
+		input.Deactivated = &atproto.AdminDefs_StatusAttr{Applied: *deactivated, Ref: ref}
+	}
+	if _, err := atproto.AdminUpdateSubjectStatus(ctx, c.client, input); err != nil {
+		return fmt.Errorf("unable to update account status, %w", err)
+	}
+	return nil
+}
+
+// DisableInviteCodes disables the invite codes, and all the invite codes of the accounts with the DIDs
+func (c *BskyAgent) DisableInviteCodes(ctx context.Context, codes, accounts []string) error {
+	err := atproto.AdminDisableInviteCodes(ctx, c.client, &atproto.AdminDisableInviteCodes_Input{
+		Codes:    codes,
+		Accounts: accounts,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to disable invite codes, %w", err)
+	}
+	return nil
+}
+
+// UpdateAccountEmail changes the email of the account of the DID, the new email is not confirmed
+func (c *BskyAgent) UpdateAccountEmail(ctx context.Context, did, email string) error {
+	err := atproto.AdminUpdateAccountEmail(ctx, c.client, &atproto.AdminUpdateAccountEmail_Input{
+		Account: did,
+		Email:   email,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update account email, %w", err)
+	}
+	return nil
+}
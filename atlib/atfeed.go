@@ -0,0 +1,155 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+const (
+	CollectionPost   = "app.bsky.feed.post"
+	CollectionLike   = "app.bsky.feed.like"
+	CollectionRepost = "app.bsky.feed.repost"
+)
+
+// The filters of app.bsky.feed.getAuthorFeed
+const (
+	FeedFilterPostsWithReplies      = "posts_with_replies"
+	FeedFilterPostsNoReplies        = "posts_no_replies"
+	FeedFilterPostsWithMedia        = "posts_with_media"
+	FeedFilterPostsAndAuthorThreads = "posts_and_author_threads"
+)
+
+const (
+	// DefaultThreadDepth and DefaultThreadParentHeight are the lexicon defaults of getPostThread
+	DefaultThreadDepth        = 6
+	DefaultThreadParentHeight = 80
+)
+
+// EditPost replaces the post with the record key rkey in the repo of the session. The creation time
+// and the reply of the original post are kept. The write fails when the post is changed in between
+func (c *BskyAgent) EditPost(ctx context.Context, rkey string, post appbsky.FeedPost) (string, string, error) {
+	record, err := c.GetRecord(ctx, c.postUri(rkey))
+	if err != nil {
+		return "", "", err
+	}
+	original, ok := record.Value.Val.(*appbsky.FeedPost)
+	if !ok {
+		return "", "", fmt.Errorf("record is not a post: %s", record.Uri)
+	}
+	post.CreatedAt = original.CreatedAt
+	post.Reply = original.Reply
+	cid, uri, err := c.PutRecord(ctx, CollectionPost, rkey, &lexutil.LexiconTypeDecoder{Val: &post}, record.Cid)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to edit post, %w", err)
+	}
+	return cid, uri, nil
+}
+
+// DeletePost deletes the post with the record key rkey in the repo of the session
+func (c *BskyAgent) DeletePost(ctx context.Context, rkey string) error {
+	uri := c.postUri(rkey)
+	// deleteRecord succeeds for a missing record, so make sure the post exists first
+	if _, err := c.GetRecord(ctx, uri); err != nil {
+		return err
+	}
+	return c.DeleteRecord(ctx, uri)
+}
+
+func (c *BskyAgent) postUri(rkey string) string {
+	return fmt.Sprintf("at://%s/%s/%s", c.client.Auth.Did, CollectionPost, rkey)
+}
+
+// Like likes the subject post, it returns the uri of the like record
+func (c *BskyAgent) Like(ctx context.Context, subject atproto.RepoStrongRef) (string, error) {
+	_, uri, err := c.CreateRecord(ctx, CollectionLike, &lexutil.LexiconTypeDecoder{Val: &appbsky.FeedLike{
+		LexiconTypeID: CollectionLike,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Subject:       &subject,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("unable to like, %w", err)
+	}
+	return uri, nil
+}
+
+// Repost reposts the subject post, it returns the uri of the repost record
+func (c *BskyAgent) Repost(ctx context.Context, subject atproto.RepoStrongRef) (string, error) {
+	_, uri, err := c.CreateRecord(ctx, CollectionRepost, &lexutil.LexiconTypeDecoder{Val: &appbsky.FeedRepost{
+		LexiconTypeID: CollectionRepost,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Subject:       &subject,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("unable to repost, %w", err)
+	}
+	return uri, nil
+}
+
+// MaxGetPosts is the max number of uris of a getPosts call
+const MaxGetPosts = 25
+
+// GetPosts returns the views of the posts with app.bsky.feed.getPosts, at most MaxGetPosts uris per call
+func (c *BskyAgent) GetPosts(ctx context.Context, uris []string) (*appbsky.FeedGetPosts_Output, error) {
+	var response *appbsky.FeedGetPosts_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.FeedGetPosts(ctx, c.client, uris)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get posts, %w", err)
+	}
+	return response, nil
+}
+
+// GetViewerState returns the like and repost of the session user on the post as seen by the app view
+func (c *BskyAgent) GetViewerState(ctx context.Context, uri string) (*appbsky.FeedDefs_ViewerState, error) {
+	posts, err := c.GetPosts(ctx, []string{uri})
+	if err != nil {
+		return nil, err
+	}
+	if len(posts.Posts) == 0 {
+		return nil, fmt.Errorf("post not found: %s", uri)
+	}
+	if posts.Posts[0].Viewer == nil {
+		return &appbsky.FeedDefs_ViewerState{}, nil
+	}
+	return posts.Posts[0].Viewer, nil
+}
+
+// GetAuthorFeed returns a page of the posts and reposts of the actor, filtered by one of the
+// FeedFilter values, posts_with_replies by default. With includePins, the pinned post comes first
+func (c *BskyAgent) GetAuthorFeed(ctx context.Context, actor, filter string, includePins bool, cursor string, limit int64) (*appbsky.FeedGetAuthorFeed_Output, error) {
+	if filter == "" {
+		filter = FeedFilterPostsWithReplies
+	}
+	var response *appbsky.FeedGetAuthorFeed_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.FeedGetAuthorFeed(ctx, c.client, actor, cursor, filter, includePins, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get author feed, %w", err)
+	}
+	return response, nil
+}
+
+// GetPostThread returns the post with depth levels of replies and parentHeight levels of parents
+func (c *BskyAgent) GetPostThread(ctx context.Context, uri string, depth, parentHeight int64) (*appbsky.FeedGetPostThread_Output, error) {
+	var response *appbsky.FeedGetPostThread_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.FeedGetPostThread(ctx, c.client, depth, parentHeight, uri)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get post thread, %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,75 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+const CollectionFollow = "app.bsky.graph.follow"
+
+// ResolveDid returns the DID of an actor given by its handle or DID
+func (c *BskyAgent) ResolveDid(ctx context.Context, actor string) (string, error) {
+	actor = strings.TrimPrefix(actor, "@")
+	if strings.HasPrefix(actor, "did:") {
+		return actor, nil
+	}
+	return c.ResolveHandle(ctx, actor)
+}
+
+// Follow follows the actor with its DID, it returns the uri of the follow record
+func (c *BskyAgent) Follow(ctx context.Context, did string) (string, error) {
+	_, uri, err := c.CreateRecord(ctx, CollectionFollow, &lexutil.LexiconTypeDecoder{Val: &appbsky.GraphFollow{
+		LexiconTypeID: CollectionFollow,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Subject:       did,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("unable to follow, %w", err)
+	}
+	return uri, nil
+}
+
+// GetProfile returns the detailed profile of an actor, with the relation of the session user to it
+func (c *BskyAgent) GetProfile(ctx context.Context, actor string) (*appbsky.ActorDefs_ProfileViewDetailed, error) {
+	var response *appbsky.ActorDefs_ProfileViewDetailed
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.ActorGetProfile(ctx, c.client, actor)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get profile, %w", err)
+	}
+	return response, nil
+}
+
+func (c *BskyAgent) GetFollowers(ctx context.Context, actor string, cursor string, limit int64) (*appbsky.GraphGetFollowers_Output, error) {
+	var response *appbsky.GraphGetFollowers_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.GraphGetFollowers(ctx, c.client, actor, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get followers, %w", err)
+	}
+	return response, nil
+}
+
+func (c *BskyAgent) GetFollows(ctx context.Context, actor string, cursor string, limit int64) (*appbsky.GraphGetFollows_Output, error) {
+	var response *appbsky.GraphGetFollows_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.GraphGetFollows(ctx, c.client, actor, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get follows, %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,186 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+const (
+	CollectionList     = "app.bsky.graph.list"
+	CollectionListItem = "app.bsky.graph.listitem"
+)
+
+// The purposes of a list: a moderation list of accounts to mute or block,
+// or a curation list used by feeds
+const (
+	ListPurposeModeration = "app.bsky.graph.defs#modlist"
+	ListPurposeCuration   = "app.bsky.graph.defs#curatelist"
+)
+
+const (
+	// listItemsPageSize is the page size used to walk through all the items of a list
+	listItemsPageSize = 100
+	// applyWritesBatchSize is the max number of writes of an applyWrites call accepted by the PDS
+	applyWritesBatchSize = 200
+)
+
+// CreateList creates a list in the repo of the session, it returns the uri of the list record
+func (c *BskyAgent) CreateList(ctx context.Context, purpose, name string, description *string) (string, error) {
+	_, uri, err := c.CreateRecord(ctx, CollectionList, &lexutil.LexiconTypeDecoder{Val: &appbsky.GraphList{
+		LexiconTypeID: CollectionList,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Name:          name,
+		Purpose:       &purpose,
+		Description:   description,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("unable to create list, %w", err)
+	}
+	return uri, nil
+}
+
+// UpdateList reads the list with the record key rkey in the repo of the session, applies update to
+// it and writes it back. The write fails when the list is changed by another client in between
+func (c *BskyAgent) UpdateList(ctx context.Context, rkey string, update func(list *appbsky.GraphList)) (string, error) {
+	record, err := c.GetRecord(ctx, c.listUri(rkey))
+	if err != nil {
+		return "", err
+	}
+	list, ok := record.Value.Val.(*appbsky.GraphList)
+	if !ok {
+		return "", fmt.Errorf("record is not a list: %s", record.Uri)
+	}
+	update(list)
+	_, uri, err := c.PutRecord(ctx, CollectionList, rkey, &lexutil.LexiconTypeDecoder{Val: list}, record.Cid)
+	if err != nil {
+		return "", fmt.Errorf("unable to update list, %w", err)
+	}
+	return uri, nil
+}
+
+// DeleteList deletes the list with the record key rkey in the repo of the session with its items,
+// which are separate records that would be left behind. The items are read from the repo, as the
+// appview may not have indexed them yet, and deleted in batches with the list last. When a batch
+// fails, the error tells how many items were deleted before, a new call deletes the remaining ones
+func (c *BskyAgent) DeleteList(ctx context.Context, rkey string) error {
+	uri := c.listUri(rkey)
+	if _, err := c.GetRecord(ctx, uri); err != nil {
+		return err
+	}
+	var writes []*atproto.RepoApplyWrites_Input_Writes_Elem
+	err := c.walkListItems(ctx, uri, func(itemRkey string, _ *appbsky.GraphListitem) bool {
+		writes = append(writes, deleteWrite(CollectionListItem, itemRkey))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	items := len(writes)
+	writes = append(writes, deleteWrite(CollectionList, rkey))
+	for start := 0; start < len(writes); start += applyWritesBatchSize {
+		end := min(start+applyWritesBatchSize, len(writes))
+		if err := c.ApplyWrites(ctx, writes[start:end]); err != nil {
+			return fmt.Errorf("unable to delete list, %d of %d items deleted, %w", start, items, err)
+		}
+	}
+	return nil
+}
+
+// AddListItem adds the actor with its DID to the list, it returns the uri of the list item record
+func (c *BskyAgent) AddListItem(ctx context.Context, listUri, did string) (string, error) {
+	_, uri, err := c.CreateRecord(ctx, CollectionListItem, &lexutil.LexiconTypeDecoder{Val: &appbsky.GraphListitem{
+		LexiconTypeID: CollectionListItem,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		List:          listUri,
+		Subject:       did,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("unable to add list item, %w", err)
+	}
+	return uri, nil
+}
+
+// FindListItem returns the uri of the item of the actor with the DID in the list of the repo of
+// the session, or an empty string when the actor is not in the list. It reads all the list items
+// of the repo, the callers look up the items they created first
+func (c *BskyAgent) FindListItem(ctx context.Context, listUri, did string) (string, error) {
+	itemUri := ""
+	err := c.walkListItems(ctx, listUri, func(itemRkey string, item *appbsky.GraphListitem) bool {
+		if item.Subject != did {
+			return true
+		}
+		itemUri = fmt.Sprintf("at://%s/%s/%s", c.client.Auth.Did, CollectionListItem, itemRkey)
+		return false
+	})
+	if err != nil {
+		return "", err
+	}
+	return itemUri, nil
+}
+
+// walkListItems calls fn with the record key of every item of the list in the repo of the session,
+// until fn returns false. The items of all the lists share a collection, they are filtered by list
+func (c *BskyAgent) walkListItems(ctx context.Context, listUri string, fn func(rkey string, item *appbsky.GraphListitem) bool) error {
+	cursor := ""
+	for {
+		page, err := c.ListRecords(ctx, CollectionListItem, cursor, listItemsPageSize)
+		if err != nil {
+			return err
+		}
+		for _, record := range page.Records {
+			item, ok := record.Value.Val.(*appbsky.GraphListitem)
+			if !ok || item.List != listUri {
+				continue
+			}
+			aturi, err := syntax.ParseATURI(record.Uri)
+			if err != nil {
+				return fmt.Errorf("invalid list item uri: %v", err)
+			}
+			if !fn(aturi.RecordKey().String(), item) {
+				return nil
+			}
+		}
+		if page.Cursor == nil || *page.Cursor == "" || len(page.Records) == 0 {
+			return nil
+		}
+		cursor = *page.Cursor
+	}
+}
+
+// GetList returns the list with a page of its items
+func (c *BskyAgent) GetList(ctx context.Context, listUri, cursor string, limit int64) (*appbsky.GraphGetList_Output, error) {
+	var response *appbsky.GraphGetList_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.GraphGetList(ctx, c.client, cursor, limit, listUri)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get list, %w", err)
+	}
+	return response, nil
+}
+
+// GetLists returns a page of the lists created by the actor
+func (c *BskyAgent) GetLists(ctx context.Context, actor, cursor string, limit int64) (*appbsky.GraphGetLists_Output, error) {
+	var response *appbsky.GraphGetLists_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.GraphGetLists(ctx, c.client, actor, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get lists, %w", err)
+	}
+	return response, nil
+}
+
+func (c *BskyAgent) listUri(rkey string) string {
+	return fmt.Sprintf("at://%s/%s/%s", c.client.Auth.Did, CollectionList, rkey)
+}
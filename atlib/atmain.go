@@ -3,7 +3,9 @@ package atlib
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -18,7 +20,14 @@ import (
 
 const defaultPDS = "https://bsky.social"
 
-var blob []lexutil.LexBlob
+// errExpiredToken is the xrpc error name returned by the PDS when the access token is expired
+const errExpiredToken = "ExpiredToken"
+
+// errRecordNotFound is the xrpc error name returned when a record does not exist
+const errRecordNotFound = "RecordNotFound"
+
+// errNotFound is the xrpc error name returned by the app view when a post does not exist
+const errNotFound = "NotFound"
 
 // Wrapper over the atproto xrpc transport
 type BskyAgent struct {
@@ -28,6 +37,10 @@ type BskyAgent struct {
 	password   string
 	email      string
 	inviteCode string
+	// called with the new tokens every time the session is refreshed
+	sessionRefreshed func(authInfo *xrpc.AuthInfo)
+	// sessionLock serializes the refreshes with the other agents of the same session
+	sessionLock func() (*xrpc.AuthInfo, func())
 }
 
 func NewBasicAgent(ctx context.Context, server string) BskyAgent {
@@ -58,6 +71,27 @@ func (c *BskyAgent) SetClientAuth(accessJwt, refreshJwt, handle, did string) {
 	}
 }
 
+// Did returns the DID of the repo of the session, empty before it is connected
+func (c *BskyAgent) Did() string {
+	if c.client.Auth == nil {
+		return ""
+	}
+	return c.client.Auth.Did
+}
+
+// SetSessionRefreshedHandler registers a callback to persist the rotated tokens
+// after the agent refreshed an expired access token
+func (c *BskyAgent) SetSessionRefreshedHandler(handler func(authInfo *xrpc.AuthInfo)) {
+	c.sessionRefreshed = handler
+}
+
+// SetSessionLockHandler registers the lock serializing the refreshes of a session shared by
+// several agents, as the PDS spends the refresh token on the first refresh. lock returns the
+// stored session once it is held, and the function releasing it
+func (c *BskyAgent) SetSessionLockHandler(lock func() (*xrpc.AuthInfo, func())) {
+	c.sessionLock = lock
+}
+
 func (c *BskyAgent) SetEmail(email string) {
 	c.email = email
 }
@@ -102,6 +136,95 @@ func (c *BskyAgent) Connect(ctx context.Context) (*xrpc.AuthInfo, error) {
 	return c.client.Auth, nil
 }
 
+// RefreshSession gets a new access/refresh token pair from com.atproto.server.refreshSession
+func (c *BskyAgent) RefreshSession(ctx context.Context) (*xrpc.AuthInfo, error) {
+	if c.client.Auth == nil || c.client.Auth.RefreshJwt == "" {
+		return nil, fmt.Errorf("no refresh token to refresh the session")
+	}
+	if c.sessionLock != nil {
+		stored, unlock := c.sessionLock()
+		defer unlock()
+		if stored != nil && stored.RefreshJwt != c.client.Auth.RefreshJwt {
+			// another agent refreshed the session in the meantime
+			c.client.Auth = stored
+			return c.client.Auth, nil
+		}
+	}
+	// refreshSession is authenticated with the refresh token instead of the access token
+	refreshClient := *c.client
+	refreshClient.Auth = &xrpc.AuthInfo{
+		AccessJwt:  c.client.Auth.RefreshJwt,
+		RefreshJwt: c.client.Auth.RefreshJwt,
+		Handle:     c.client.Auth.Handle,
+		Did:        c.client.Auth.Did,
+	}
+	session, err := atproto.ServerRefreshSession(ctx, &refreshClient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh session, %w", err)
+	}
+	c.client.Auth = &xrpc.AuthInfo{
+		AccessJwt:  session.AccessJwt,
+		RefreshJwt: session.RefreshJwt,
+		Handle:     session.Handle,
+		Did:        session.Did,
+	}
+	if c.sessionRefreshed != nil {
+		c.sessionRefreshed(c.client.Auth)
+	}
+	return c.client.Auth, nil
+}
+
+// withRefresh runs the xrpc call and, if the access token is expired,
+// refreshes the session and retries the call once
+func (c *BskyAgent) withRefresh(ctx context.Context, call func() error) error {
+	err := call()
+	if !IsExpiredToken(err) {
+		return err
+	}
+	if _, refreshErr := c.RefreshSession(ctx); refreshErr != nil {
+		log.Printf("Refresh expired pds session failed. %v", refreshErr)
+		return err
+	}
+	return call()
+}
+
+// IsExpiredToken reports whether err is the ExpiredToken error of the PDS
+func IsExpiredToken(err error) bool {
+	return isXRPCError(err, errExpiredToken)
+}
+
+// IsRecordNotFound reports whether err is the RecordNotFound error of com.atproto.repo.getRecord
+func IsRecordNotFound(err error) bool {
+	return isXRPCError(err, errRecordNotFound)
+}
+
+// IsNotFound reports whether err is the NotFound error of app.bsky.feed.getPostThread
+func IsNotFound(err error) bool {
+	return isXRPCError(err, errNotFound)
+}
+
+func isXRPCError(err error, name string) bool {
+	var xrpcErr *xrpc.XRPCError
+	if errors.As(err, &xrpcErr) {
+		return xrpcErr.ErrStr == name
+	}
+	return false
+}
+
+// GetSession returns the current session, refreshing it if the access token is expired
+func (c *BskyAgent) GetSession(ctx context.Context) (*atproto.ServerGetSession_Output, error) {
+	var session *atproto.ServerGetSession_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		session, err = atproto.ServerGetSession(ctx, c.client)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
 func HandlerValidSession(ctx context.Context, server string, authInfo *xrpc.AuthInfo) error {
 	agent := NewBasicAgent(ctx, server)
 	agent.client.Auth = authInfo
@@ -147,67 +270,63 @@ func CreateAccount(ctx context.Context, server, username, password, email, invit
 }
 
 func (c *BskyAgent) UploadImages(ctx context.Context, images ...Image) ([]lexutil.LexBlob, error) {
+	var blobs []lexutil.LexBlob
 	for _, img := range images {
-		getImage, err := getImageAsBuffer(img.Uri.String())
-		if err != nil {
-			log.Printf("Couldn't retrive the image: %v , %v", img, err)
-		}
-
-		resp, err := atproto.RepoUploadBlob(ctx, c.client, bytes.NewReader(getImage))
+		blob, err := c.UploadImage(ctx, img)
 		if err != nil {
 			return nil, err
 		}
-
-		blob = append(blob, lexutil.LexBlob{
-			Ref:      resp.Blob.Ref,
-			MimeType: resp.Blob.MimeType,
-			Size:     resp.Blob.Size,
-		})
+		blobs = append(blobs, *blob)
 	}
-	return blob, nil
+	return blobs, nil
 }
 
 func (c *BskyAgent) UploadImage(ctx context.Context, image Image) (*lexutil.LexBlob, error) {
 	getImage, err := getImageAsBuffer(image.Uri.String())
 	if err != nil {
 		log.Printf("Couldn't retrive the image: %v , %v", image, err)
-	}
-
-	resp, err := atproto.RepoUploadBlob(ctx, c.client, bytes.NewReader(getImage))
-	if err != nil {
 		return nil, err
 	}
+	return c.UploadBlob(ctx, bytes.NewReader(getImage), http.DetectContentType(getImage))
+}
 
-	blob := lexutil.LexBlob{
-		Ref:      resp.Blob.Ref,
-		MimeType: resp.Blob.MimeType,
-		Size:     resp.Blob.Size,
+// UploadBlob streams data to com.atproto.repo.uploadBlob with the given MIME type.
+// data is rewound when the call is retried after refreshing an expired session
+func (c *BskyAgent) UploadBlob(ctx context.Context, data io.ReadSeeker, mimeType string) (*lexutil.LexBlob, error) {
+	var out atproto.RepoUploadBlob_Output
+	err := c.withRefresh(ctx, func() error {
+		if _, err := data.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return c.client.Do(ctx, xrpc.Procedure, mimeType, "com.atproto.repo.uploadBlob", nil, data, &out)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload blob, %w", err)
 	}
-
-	return &blob, nil
+	return &lexutil.LexBlob{
+		Ref:      out.Blob.Ref,
+		MimeType: out.Blob.MimeType,
+		Size:     out.Blob.Size,
+	}, nil
 }
 
 func (c *BskyAgent) PostToFeed(ctx context.Context, post appbsky.FeedPost) (string, string, error) {
 
-	post_input := &atproto.RepoCreateRecord_Input{
-		// collection: The NSID of the record collection.
-		Collection: "app.bsky.feed.post",
-		// repo: The handle or DID of the repo (aka, current account).
-		Repo: c.client.Auth.Did,
-		// record: The record itself. Must contain a $type field.
-		Record: &lexutil.LexiconTypeDecoder{Val: &post},
-	}
-
-	response, err := atproto.RepoCreateRecord(ctx, c.client, post_input)
+	cid, uri, err := c.CreateRecord(ctx, CollectionPost, &lexutil.LexiconTypeDecoder{Val: &post})
 	if err != nil {
 		return "", "", fmt.Errorf("unable to post, %v", err)
 	}
 
-	return response.Cid, response.Uri, nil
+	return cid, uri, nil
 }
 
 func (c *BskyAgent) GetTimeline(ctx context.Context, cursor string, limit int64) (*bsky.FeedGetTimeline_Output, error) {
-	response, err := bsky.FeedGetTimeline(ctx, c.client, "reverse-chronological", cursor, limit)
+	var response *bsky.FeedGetTimeline_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = bsky.FeedGetTimeline(ctx, c.client, "reverse-chronological", cursor, limit)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to get timeline, %v", err)
 	}
@@ -0,0 +1,97 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+const CollectionBlock = "app.bsky.graph.block"
+
+// MuteActor mutes the actor, by handle or DID, for the session user. Mutes are private,
+// they are kept by the app view and not in the repo
+func (c *BskyAgent) MuteActor(ctx context.Context, actor string) error {
+	err := c.withRefresh(ctx, func() error {
+		return appbsky.GraphMuteActor(ctx, c.client, &appbsky.GraphMuteActor_Input{Actor: actor})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mute actor, %w", err)
+	}
+	return nil
+}
+
+func (c *BskyAgent) UnmuteActor(ctx context.Context, actor string) error {
+	err := c.withRefresh(ctx, func() error {
+		return appbsky.GraphUnmuteActor(ctx, c.client, &appbsky.GraphUnmuteActor_Input{Actor: actor})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to unmute actor, %w", err)
+	}
+	return nil
+}
+
+// GetMutes returns a page of the actors muted by the session user
+func (c *BskyAgent) GetMutes(ctx context.Context, cursor string, limit int64) (*appbsky.GraphGetMutes_Output, error) {
+	var response *appbsky.GraphGetMutes_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.GraphGetMutes(ctx, c.client, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get mutes, %w", err)
+	}
+	return response, nil
+}
+
+// MuteThread stops the notifications of the thread of the root post for the session user
+func (c *BskyAgent) MuteThread(ctx context.Context, root string) error {
+	err := c.withRefresh(ctx, func() error {
+		return appbsky.GraphMuteThread(ctx, c.client, &appbsky.GraphMuteThread_Input{Root: root})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mute thread, %w", err)
+	}
+	return nil
+}
+
+func (c *BskyAgent) UnmuteThread(ctx context.Context, root string) error {
+	err := c.withRefresh(ctx, func() error {
+		return appbsky.GraphUnmuteThread(ctx, c.client, &appbsky.GraphUnmuteThread_Input{Root: root})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to unmute thread, %w", err)
+	}
+	return nil
+}
+
+// Block blocks the actor with its DID, it returns the uri of the block record.
+// Unlike mutes, blocks are public records of the repo
+func (c *BskyAgent) Block(ctx context.Context, did string) (string, error) {
+	_, uri, err := c.CreateRecord(ctx, CollectionBlock, &lexutil.LexiconTypeDecoder{Val: &appbsky.GraphBlock{
+		LexiconTypeID: CollectionBlock,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Subject:       did,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("unable to block, %w", err)
+	}
+	return uri, nil
+}
+
+// GetBlocks returns a page of the actors blocked by the session user
+func (c *BskyAgent) GetBlocks(ctx context.Context, cursor string, limit int64) (*appbsky.GraphGetBlocks_Output, error) {
+	var response *appbsky.GraphGetBlocks_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.GraphGetBlocks(ctx, c.client, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get blocks, %w", err)
+	}
+	return response, nil
+}
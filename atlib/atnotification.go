@@ -0,0 +1,66 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// ListNotifications returns a page of the notifications of the session user. With reasons, only the
+// notifications of these reasons are returned, the page is also filtered here for the app views ignoring it.
+// Raw call: NotificationListNotifications has no reasons parameter in indigo before 2025-03
+func (c *BskyAgent) ListNotifications(ctx context.Context, cursor string, limit int64, reasons []string) (*appbsky.NotificationListNotifications_Output, error) {
+	params := map[string]interface{}{
+		"limit": limit,
+	}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+	if len(reasons) > 0 {
+		params["reasons"] = reasons
+	}
+	var response appbsky.NotificationListNotifications_Output
+	err := c.withRefresh(ctx, func() error {
+		return c.client.Do(ctx, xrpc.Query, "", "app.bsky.notification.listNotifications", params, nil, &response)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list notifications, %w", err)
+	}
+	if len(reasons) > 0 {
+		response.Notifications = slices.DeleteFunc(response.Notifications, func(n *appbsky.NotificationListNotifications_Notification) bool {
+			return !slices.Contains(reasons, n.Reason)
+		})
+	}
+	return &response, nil
+}
+
+// GetUnreadCount returns the number of notifications not seen yet by the session user
+func (c *BskyAgent) GetUnreadCount(ctx context.Context) (int64, error) {
+	var response *appbsky.NotificationGetUnreadCount_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.NotificationGetUnreadCount(ctx, c.client, false, "")
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to get unread count, %w", err)
+	}
+	return response.Count, nil
+}
+
+// UpdateSeen marks the notifications indexed before seenAt as read
+func (c *BskyAgent) UpdateSeen(ctx context.Context, seenAt time.Time) error {
+	err := c.withRefresh(ctx, func() error {
+		return appbsky.NotificationUpdateSeen(ctx, c.client, &appbsky.NotificationUpdateSeen_Input{
+			SeenAt: seenAt.UTC().Format(time.RFC3339Nano),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update seen, %w", err)
+	}
+	return nil
+}
@@ -7,12 +7,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 )
 
-var FeedPost_Embed appbsky.FeedPost_Embed
-
 type Facet_Type int
 
 const (
@@ -26,18 +25,25 @@ type PostBuilder struct {
 	Text  string
 	Facet []Facet
 	Embed Embed
+	Reply *appbsky.FeedPost_ReplyRef
 }
 
 type Facet struct {
 	Ftype   Facet_Type
 	Value   string
 	T_facet string
+	// ByteStart and ByteEnd are the UTF-8 byte range of the facet in the text.
+	// When they are not set, Build looks for T_facet in the text
+	ByteStart int
+	ByteEnd   int
 }
 
 type Embed struct {
 	Link           Link
 	Images         []Image
 	UploadedImages []lexutil.LexBlob
+	// Record is the quoted record
+	Record *atproto.RepoStrongRef
 }
 
 type Link struct {
@@ -50,6 +56,9 @@ type Link struct {
 type Image struct {
 	Title string
 	Uri   url.URL
+	// Width and Height are used as the aspect ratio of the image when set
+	Width  int64
+	Height int64
 }
 
 // Create a simple post with text
@@ -72,6 +81,14 @@ func (pb PostBuilder) WithFacet(ftype Facet_Type, value string, text string) Pos
 	return pb
 }
 
+// Add facets with their byte range, as returned by ParseFacets or DetectFacets
+func (pb PostBuilder) WithFacets(facets []Facet) PostBuilder {
+
+	pb.Facet = append(pb.Facet, facets...)
+
+	return pb
+}
+
 // Create a Post with external links
 func (pb PostBuilder) WithExternalLink(title string, link url.URL, description string, thumb lexutil.LexBlob) PostBuilder {
 
@@ -92,11 +109,34 @@ func (pb PostBuilder) WithImages(blobs []lexutil.LexBlob, images []Image) PostBu
 	return pb
 }
 
+// Create a reply to the parent post of the thread starting at root
+func (pb PostBuilder) WithReply(root atproto.RepoStrongRef, parent atproto.RepoStrongRef) PostBuilder {
+
+	pb.Reply = &appbsky.FeedPost_ReplyRef{
+		Root:   &root,
+		Parent: &parent,
+	}
+
+	return pb
+}
+
+// Create a Post quoting a record, it can be combined with an external link or images
+func (pb PostBuilder) WithQuote(record atproto.RepoStrongRef) PostBuilder {
+
+	pb.Embed.Record = &record
+
+	return pb
+}
+
 // Build the request
 func (pb PostBuilder) Build() (appbsky.FeedPost, error) {
 
 	post := appbsky.FeedPost{}
 
+	if length := GraphemeLength(pb.Text); length > MaxPostGraphemes {
+		return post, fmt.Errorf("post text is too long: %d characters, the limit is %d", length, MaxPostGraphemes)
+	}
+
 	post.Text = pb.Text
 	post.LexiconTypeID = "app.bsky.feed.post"
 	post.CreatedAt = time.Now().Format(time.RFC3339)
@@ -105,6 +145,8 @@ func (pb PostBuilder) Build() (appbsky.FeedPost, error) {
 	// https://docs.bsky.app/docs/advanced-guides/post-richtext
 
 	Facets := []*appbsky.RichtextFacet{}
+	// the next search offset of each facet text, so a repeated text gets the next occurrence
+	searchFrom := make(map[string]int)
 
 	for _, f := range pb.Facet {
 		facet := &appbsky.RichtextFacet{}
@@ -148,9 +190,18 @@ func (pb PostBuilder) Build() (appbsky.FeedPost, error) {
 		features = append(features, feature)
 		facet.Features = features
 
-		ByteStart, ByteEnd, err := findSubstring(post.Text, f.T_facet)
-		if err != nil {
-			return post, fmt.Errorf("unable to find the substring: %v , %v", f.T_facet, err)
+		ByteStart, ByteEnd := f.ByteStart, f.ByteEnd
+		if ByteEnd > 0 {
+			if ByteStart < 0 || ByteStart >= ByteEnd || ByteEnd > len(post.Text) {
+				return post, fmt.Errorf("invalid facet byte range: %d-%d", ByteStart, ByteEnd)
+			}
+		} else {
+			var err error
+			ByteStart, ByteEnd, err = findSubstring(post.Text, f.T_facet, searchFrom[f.T_facet])
+			if err != nil {
+				return post, fmt.Errorf("unable to find the substring: %v , %v", f.T_facet, err)
+			}
+			searchFrom[f.T_facet] = ByteEnd
 		}
 
 		index := &appbsky.RichtextFacet_ByteSlice{
@@ -163,19 +214,27 @@ func (pb PostBuilder) Build() (appbsky.FeedPost, error) {
 	}
 
 	post.Facets = Facets
+	post.Reply = pb.Reply
 
 	// Embed Section (either external links or images)
-	// As of now it allows only one Embed type per post:
+	// As of now it allows only one Embed type per post, a quote with media uses recordWithMedia:
 	// https://github.com/bluesky-social/indigo/blob/main/api/bsky/feedpost.go
 	if pb.Embed.Link != (Link{}) {
 
-		FeedPost_Embed.EmbedExternal = &appbsky.EmbedExternal{
-			LexiconTypeID: "app.bsky.embed.external",
-			External: &appbsky.EmbedExternal_External{
-				Title:       pb.Embed.Link.Title,
-				Uri:         pb.Embed.Link.Uri.String(),
-				Description: pb.Embed.Link.Description,
-				Thumb:       &pb.Embed.Link.Thumb,
+		external := &appbsky.EmbedExternal_External{
+			Title:       pb.Embed.Link.Title,
+			Uri:         pb.Embed.Link.Uri.String(),
+			Description: pb.Embed.Link.Description,
+		}
+		// avoid sending an empty blob when the link has no preview image
+		if pb.Embed.Link.Thumb.Ref.Defined() {
+			thumb := pb.Embed.Link.Thumb
+			external.Thumb = &thumb
+		}
+		post.Embed = &appbsky.FeedPost_Embed{
+			EmbedExternal: &appbsky.EmbedExternal{
+				LexiconTypeID: "app.bsky.embed.external",
+				External:      external,
 			},
 		}
 
@@ -192,21 +251,61 @@ func (pb PostBuilder) Build() (appbsky.FeedPost, error) {
 					Alt:   img.Title,
 					Image: &pb.Embed.UploadedImages[i],
 				}
+				if img.Width > 0 && img.Height > 0 {
+					EmbedImages.Images[i].AspectRatio = &appbsky.EmbedDefs_AspectRatio{
+						Width:  img.Width,
+						Height: img.Height,
+					}
+				}
 			}
 
-			FeedPost_Embed.EmbedImages = &EmbedImages
+			post.Embed = &appbsky.FeedPost_Embed{
+				EmbedImages: &EmbedImages,
+			}
 
 		}
 	}
 
-	// avoid error when trying to marshal empty field (*bsky.FeedPost_Embed)
-	if len(pb.Embed.Images) != 0 || pb.Embed.Link.Title != "" {
-		post.Embed = &FeedPost_Embed
+	if pb.Embed.Record != nil {
+		record := &appbsky.EmbedRecord{
+			LexiconTypeID: "app.bsky.embed.record",
+			Record:        pb.Embed.Record,
+		}
+		if post.Embed == nil {
+			post.Embed = &appbsky.FeedPost_Embed{
+				EmbedRecord: record,
+			}
+		} else {
+			post.Embed = &appbsky.FeedPost_Embed{
+				EmbedRecordWithMedia: &appbsky.EmbedRecordWithMedia{
+					LexiconTypeID: "app.bsky.embed.recordWithMedia",
+					Record:        record,
+					Media: &appbsky.EmbedRecordWithMedia_Media{
+						EmbedImages:   post.Embed.EmbedImages,
+						EmbedExternal: post.Embed.EmbedExternal,
+					},
+				},
+			}
+		}
 	}
 
 	return post, nil
 }
 
+// ParseFacetType returns the facet type of its short name: link, mention or tag
+func ParseFacetType(name string) (Facet_Type, error) {
+	switch name {
+	case "link":
+		return Facet_Link, nil
+	case "mention":
+		return Facet_Mention, nil
+	case "tag":
+		return Facet_Tag, nil
+	default:
+		return 0, fmt.Errorf("unknown facet type: %s", name)
+	}
+}
+
 func (f Facet_Type) String() string {
 	switch f {
 	case Facet_Link:
@@ -219,10 +318,11 @@ func (f Facet_Type) String() string {
 		return "Unknown"
 	}
 }
-func findSubstring(s, substr string) (int, int, error) {
-	index := strings.Index(s, substr)
+func findSubstring(s, substr string, from int) (int, int, error) {
+	index := strings.Index(s[from:], substr)
 	if index == -1 {
 		return 0, 0, errors.New("substring not found")
 	}
+	index += from
 	return index, index + len(substr), nil
 }
@@ -0,0 +1,46 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+const CollectionProfile = "app.bsky.actor.profile"
+
+// profileRkey is the record key of the only profile record of a repo
+const profileRkey = "self"
+
+// UpdateProfile reads the profile record of the session user, applies update to it and writes it back.
+// The write fails when the profile is changed by another client in between
+func (c *BskyAgent) UpdateProfile(ctx context.Context, update func(profile *appbsky.ActorProfile)) error {
+	uri := fmt.Sprintf("at://%s/%s/%s", c.client.Auth.Did, CollectionProfile, profileRkey)
+	profile := &appbsky.ActorProfile{}
+	// a nil swap record means the profile must not exist yet
+	var swapRecord *string
+	record, err := c.GetRecord(ctx, uri)
+	if err == nil {
+		existing, ok := record.Value.Val.(*appbsky.ActorProfile)
+		if !ok {
+			return fmt.Errorf("invalid profile record: %s", uri)
+		}
+		profile = existing
+		swapRecord = record.Cid
+	} else if !IsRecordNotFound(err) {
+		return err
+	}
+	profile.LexiconTypeID = CollectionProfile
+	if profile.CreatedAt == nil {
+		createdAt := time.Now().Format(time.RFC3339)
+		profile.CreatedAt = &createdAt
+	}
+	update(profile)
+	_, _, err = c.PutRecord(ctx, CollectionProfile, profileRkey, &lexutil.LexiconTypeDecoder{Val: profile}, swapRecord)
+	if err != nil {
+		return fmt.Errorf("unable to update profile, %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+// GetRecord reads a record of any repo by its AT-URI with com.atproto.repo.getRecord
+func (c *BskyAgent) GetRecord(ctx context.Context, uri string) (*atproto.RepoGetRecord_Output, error) {
+	aturi, err := syntax.ParseATURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record uri: %v", err)
+	}
+	if aturi.Collection() == "" || aturi.RecordKey() == "" {
+		return nil, fmt.Errorf("record uri must have a collection and a record key: %s", uri)
+	}
+	var out *atproto.RepoGetRecord_Output
+	err = c.withRefresh(ctx, func() error {
+		var err error
+		out, err = atproto.RepoGetRecord(ctx, c.client, "", aturi.Collection().String(), aturi.Authority().String(), aturi.RecordKey().String())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get record, %w", err)
+	}
+	if out.Cid == nil {
+		return nil, fmt.Errorf("record has no cid: %s", uri)
+	}
+	return out, nil
+}
+
+// GetRecordRef resolves the AT-URI of a record to the strong reference (uri and cid) used by
+// quotes, likes and reposts
+func (c *BskyAgent) GetRecordRef(ctx context.Context, uri string) (*atproto.RepoStrongRef, error) {
+	record, err := c.GetRecord(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return &atproto.RepoStrongRef{
+		Uri: record.Uri,
+		Cid: *record.Cid,
+	}, nil
+}
+
+// GetReplyRef returns the reply reference of a post answering the parent post.
+// The root is the root of the parent when the parent is itself a reply
+func (c *BskyAgent) GetReplyRef(ctx context.Context, parentUri string) (*appbsky.FeedPost_ReplyRef, error) {
+	record, err := c.GetRecord(ctx, parentUri)
+	if err != nil {
+		return nil, err
+	}
+	parentPost, ok := record.Value.Val.(*appbsky.FeedPost)
+	if !ok {
+		return nil, fmt.Errorf("record is not a post: %s", parentUri)
+	}
+	parent := &atproto.RepoStrongRef{
+		Uri: record.Uri,
+		Cid: *record.Cid,
+	}
+	root := parent
+	if parentPost.Reply != nil && parentPost.Reply.Root != nil {
+		root = parentPost.Reply.Root
+	}
+	return &appbsky.FeedPost_ReplyRef{
+		Root:   root,
+		Parent: parent,
+	}, nil
+}
+
+// CreateRecord creates a record in the repo of the session, it returns the cid and the uri of the record
+func (c *BskyAgent) CreateRecord(ctx context.Context, collection string, record *lexutil.LexiconTypeDecoder) (string, string, error) {
+	input := &atproto.RepoCreateRecord_Input{
+		// collection: The NSID of the record collection.
+		Collection: collection,
+		// repo: The handle or DID of the repo (aka, current account).
+		Repo: c.client.Auth.Did,
+		// record: The record itself. Must contain a $type field.
+		Record: record,
+	}
+	var response *atproto.RepoCreateRecord_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = atproto.RepoCreateRecord(ctx, c.client, input)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return response.Cid, response.Uri, nil
+}
+
+// PutRecord creates or replaces the record with the key rkey in the repo of the session. When swapRecord
+// is nil the record must not exist yet, else it must still have the cid swapRecord
+func (c *BskyAgent) PutRecord(ctx context.Context, collection, rkey string, record *lexutil.LexiconTypeDecoder, swapRecord *string) (string, string, error) {
+	input := &atproto.RepoPutRecord_Input{
+		Collection: collection,
+		Repo:       c.client.Auth.Did,
+		Rkey:       rkey,
+		Record:     record,
+		SwapRecord: swapRecord,
+	}
+	var response *atproto.RepoPutRecord_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = atproto.RepoPutRecord(ctx, c.client, input)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return response.Cid, response.Uri, nil
+}
+
+// DeleteRecord deletes a record of the repo of the session by its AT-URI with
+// com.atproto.repo.deleteRecord
+func (c *BskyAgent) DeleteRecord(ctx context.Context, uri string) error {
+	aturi, err := syntax.ParseATURI(uri)
+	if err != nil {
+		return fmt.Errorf("invalid record uri: %v", err)
+	}
+	input := &atproto.RepoDeleteRecord_Input{
+		Collection: aturi.Collection().String(),
+		Repo:       c.client.Auth.Did,
+		Rkey:       aturi.RecordKey().String(),
+	}
+	err = c.withRefresh(ctx, func() error {
+		_, err := atproto.RepoDeleteRecord(ctx, c.client, input)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete record, %w", err)
+	}
+	return nil
+}
+
+// ListRecords returns a page of the records of the collection in the repo of the session
+func (c *BskyAgent) ListRecords(ctx context.Context, collection, cursor string, limit int64) (*atproto.RepoListRecords_Output, error) {
+	var response *atproto.RepoListRecords_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = atproto.RepoListRecords(ctx, c.client, collection, cursor, limit, c.client.Auth.Did, false, "", "")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records, %w", err)
+	}
+	return response, nil
+}
+
+// ApplyWrites applies the writes to the repo of the session in a single commit, they all fail
+// or succeed together
+func (c *BskyAgent) ApplyWrites(ctx context.Context, writes []*atproto.RepoApplyWrites_Input_Writes_Elem) error {
+	input := &atproto.RepoApplyWrites_Input{
+		Repo:   c.client.Auth.Did,
+		Writes: writes,
+	}
+	err := c.withRefresh(ctx, func() error {
+		_, err := atproto.RepoApplyWrites(ctx, c.client, input)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to apply writes, %w", err)
+	}
+	return nil
+}
+
+func deleteWrite(collection, rkey string) *atproto.RepoApplyWrites_Input_Writes_Elem {
+	return &atproto.RepoApplyWrites_Input_Writes_Elem{
+		RepoApplyWrites_Delete: &atproto.RepoApplyWrites_Delete{
+			Collection: collection,
+			Rkey:       rkey,
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+)
+
+// The reason types of com.atproto.moderation.createReport
+const (
+	ReasonSpam       = "com.atproto.moderation.defs#reasonSpam"
+	ReasonViolation  = "com.atproto.moderation.defs#reasonViolation"
+	ReasonMisleading = "com.atproto.moderation.defs#reasonMisleading"
+	ReasonSexual     = "com.atproto.moderation.defs#reasonSexual"
+	ReasonRude       = "com.atproto.moderation.defs#reasonRude"
+	ReasonOther      = "com.atproto.moderation.defs#reasonOther"
+)
+
+// ReportAccount reports the account with the DID to the moderation service of the PDS,
+// it returns the id of the report
+func (c *BskyAgent) ReportAccount(ctx context.Context, did, reasonType string, reason *string) (int64, error) {
+	return c.createReport(ctx, reasonType, reason, &atproto.ModerationCreateReport_Input_Subject{
+		AdminDefs_RepoRef: &atproto.AdminDefs_RepoRef{
+			LexiconTypeID: "com.atproto.admin.defs#repoRef",
+			Did:           did,
+		},
+	})
+}
+
+// ReportRecord reports a record, like a post, to the moderation service of the PDS,
+// it returns the id of the report
+func (c *BskyAgent) ReportRecord(ctx context.Context, record atproto.RepoStrongRef, reasonType string, reason *string) (int64, error) {
+	record.LexiconTypeID = "com.atproto.repo.strongRef"
+	return c.createReport(ctx, reasonType, reason, &atproto.ModerationCreateReport_Input_Subject{
+		RepoStrongRef: &record,
+	})
+}
+
+func (c *BskyAgent) createReport(ctx context.Context, reasonType string, reason *string, subject *atproto.ModerationCreateReport_Input_Subject) (int64, error) {
+	var response *atproto.ModerationCreateReport_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = atproto.ModerationCreateReport(ctx, c.client, &atproto.ModerationCreateReport_Input{
+			ReasonType: &reasonType,
+			Reason:     reason,
+			Subject:    subject,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to create report, %w", err)
+	}
+	return response.Id, nil
+}
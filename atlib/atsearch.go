@@ -0,0 +1,95 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// The sort orders of app.bsky.feed.searchPosts
+const (
+	SearchSortTop    = "top"
+	SearchSortLatest = "latest"
+)
+
+// SearchPostsParams are the filters of a post search, the empty ones are not sent
+type SearchPostsParams struct {
+	Query string
+	// Sort is SearchSortTop or SearchSortLatest, latest by default
+	Sort string
+	// Since and Until bound the creation time, as a datetime or a YYYY-MM-DD date
+	Since string
+	Until string
+	// Author and Mentions are a handle or a DID
+	Author   string
+	Mentions string
+	Lang     string
+	// Tags are hashtags without the #, the posts must have all of them
+	Tags   []string
+	Cursor string
+	Limit  int64
+}
+
+// SearchActors returns a page of the actors matching the query on their handle, display name and description
+func (c *BskyAgent) SearchActors(ctx context.Context, query string, cursor string, limit int64) (*appbsky.ActorSearchActors_Output, error) {
+	var response *appbsky.ActorSearchActors_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.ActorSearchActors(ctx, c.client, cursor, limit, query, "")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search actors, %w", err)
+	}
+	return response, nil
+}
+
+// SearchActorsTypeahead returns the actors whose handle or display name starts with the query,
+// for autocompletion. It has no pagination
+func (c *BskyAgent) SearchActorsTypeahead(ctx context.Context, query string, limit int64) (*appbsky.ActorSearchActorsTypeahead_Output, error) {
+	var response *appbsky.ActorSearchActorsTypeahead_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		response, err = appbsky.ActorSearchActorsTypeahead(ctx, c.client, limit, query, "")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search actors typeahead, %w", err)
+	}
+	return response, nil
+}
+
+// SearchPosts returns a page of the posts matching the query and the filters with
+// app.bsky.feed.searchPosts. Raw call: FeedSearchPosts sends the unset filters as empty values
+func (c *BskyAgent) SearchPosts(ctx context.Context, search SearchPostsParams) (*appbsky.FeedSearchPosts_Output, error) {
+	params := map[string]interface{}{
+		"q":     search.Query,
+		"limit": search.Limit,
+	}
+	for name, value := range map[string]string{
+		"sort":     search.Sort,
+		"since":    search.Since,
+		"until":    search.Until,
+		"author":   search.Author,
+		"mentions": search.Mentions,
+		"lang":     search.Lang,
+		"cursor":   search.Cursor,
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	if len(search.Tags) > 0 {
+		params["tag"] = search.Tags
+	}
+	var response appbsky.FeedSearchPosts_Output
+	err := c.withRefresh(ctx, func() error {
+		return c.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.searchPosts", params, nil, &response)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search posts, %w", err)
+	}
+	return &response, nil
+}
@@ -0,0 +1,155 @@
+package atlib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+)
+
+// maxTagLength is the max length in characters of a hashtag, without the #
+const maxTagLength = 64
+
+// The patterns follow the detection rules of the official bluesky client
+// https://github.com/bluesky-social/atproto/blob/main/packages/api/src/rich-text/util.ts,
+// except a tag ends at the next #, so #a#b is the tag a
+var (
+	mentionRegex = regexp.MustCompile(`(?:^|\s|\()(@(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)\b`)
+	linkRegex    = regexp.MustCompile(`(?:^|\s|\()(https?://\S+)`)
+	tagRegex     = regexp.MustCompile(`(?:^|\s)([#＃][^\s#＃]+)`)
+)
+
+// ParseFacets finds every mention, link and hashtag of the text with their UTF-8 byte range.
+// The value of a mention facet is the handle, it must be resolved to a DID before posting
+func ParseFacets(text string) []Facet {
+	var facets []Facet
+	for _, match := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		facets = append(facets, Facet{
+			Ftype:     Facet_Mention,
+			Value:     text[start+1 : end],
+			T_facet:   text[start:end],
+			ByteStart: start,
+			ByteEnd:   end,
+		})
+	}
+	for _, match := range linkRegex.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], trimLinkEnd(text, match[2], match[3])
+		facets = append(facets, Facet{
+			Ftype:     Facet_Link,
+			Value:     text[start:end],
+			T_facet:   text[start:end],
+			ByteStart: start,
+			ByteEnd:   end,
+		})
+	}
+	for _, match := range tagRegex.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], trimPunctuationEnd(text, match[2], match[3])
+		_, hashSize := utf8.DecodeRuneInString(text[start:])
+		tag := text[start+hashSize : end]
+		if !isValidTag(tag) {
+			continue
+		}
+		facets = append(facets, Facet{
+			Ftype:     Facet_Tag,
+			Value:     tag,
+			T_facet:   text[start:end],
+			ByteStart: start,
+			ByteEnd:   end,
+		})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		return facets[i].ByteStart < facets[j].ByteStart
+	})
+	return facets
+}
+
+// DetectFacets parses the facets of the text and resolves the mentioned handles to DIDs.
+// Mentions of handles that can not be resolved are left as plain text
+func (c *BskyAgent) DetectFacets(ctx context.Context, text string) []Facet {
+	parsed := ParseFacets(text)
+	facets := make([]Facet, 0, len(parsed))
+	dids := make(map[string]string)
+	for _, facet := range parsed {
+		if facet.Ftype == Facet_Mention {
+			handle := strings.ToLower(facet.Value)
+			did, resolved := dids[handle]
+			if !resolved {
+				var err error
+				did, err = c.ResolveHandle(ctx, handle)
+				if err != nil {
+					log.Printf("Unable to resolve mentioned handle %s: %v", handle, err)
+				}
+				dids[handle] = did
+			}
+			if did == "" {
+				continue
+			}
+			facet.Value = did
+		}
+		facets = append(facets, facet)
+	}
+	return facets
+}
+
+// ResolveHandle returns the DID of the handle with com.atproto.identity.resolveHandle
+func (c *BskyAgent) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	var out *atproto.IdentityResolveHandle_Output
+	err := c.withRefresh(ctx, func() error {
+		var err error
+		out, err = atproto.IdentityResolveHandle(ctx, c.client, handle)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve handle, %w", err)
+	}
+	return out.Did, nil
+}
+
+// trimLinkEnd drops the punctuation ending a sentence and the unbalanced closing
+// parenthesis after a link
+func trimLinkEnd(text string, start, end int) int {
+	for end > start {
+		last := text[end-1]
+		if strings.IndexByte(".,;:!?\"'", last) >= 0 {
+			end--
+			continue
+		}
+		if last == ')' && strings.Count(text[start:end], "(") < strings.Count(text[start:end], ")") {
+			end--
+			continue
+		}
+		break
+	}
+	return end
+}
+
+func trimPunctuationEnd(text string, start, end int) int {
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[start:end])
+		if !unicode.IsPunct(r) {
+			break
+		}
+		end -= size
+	}
+	return end
+}
+
+// isValidTag rejects empty, too long and number only hashtags
+func isValidTag(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+		return false
+	}
+	for _, r := range tag {
+		if !unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package atlib
+
+import "testing"
+
+func TestParseFacets(t *testing.T) {
+	type want struct {
+		ftype      Facet_Type
+		value      string
+		start, end int
+	}
+	tests := []struct {
+		name   string
+		text   string
+		facets []want
+	}{
+		{
+			name: "mentions after multibyte text",
+			text: "chào @alice.test và @bob.test",
+			facets: []want{
+				{Facet_Mention, "alice.test", 6, 17},
+				{Facet_Mention, "bob.test", 22, 31},
+			},
+		},
+		{
+			name: "repeated mention",
+			text: "@a.test hi @a.test",
+			facets: []want{
+				{Facet_Mention, "a.test", 0, 7},
+				{Facet_Mention, "a.test", 11, 18},
+			},
+		},
+		{
+			name:   "mention inside a word",
+			text:   "mail@a.test",
+			facets: nil,
+		},
+		{
+			name: "link without the ending punctuation",
+			text: "xem https://example.com/ảnh.",
+			facets: []want{
+				{Facet_Link, "https://example.com/ảnh", 4, 29},
+			},
+		},
+		{
+			name: "link with balanced parentheses in parentheses",
+			text: "(see https://example.com/a_(b))",
+			facets: []want{
+				{Facet_Link, "https://example.com/a_(b)", 5, 30},
+			},
+		},
+		{
+			name: "tags after an emoji",
+			text: "🎉 #tiếng #a#b #123 #end.",
+			facets: []want{
+				{Facet_Tag, "tiếng", 5, 13},
+				{Facet_Tag, "a", 14, 16},
+				{Facet_Tag, "end", 24, 28},
+			},
+		},
+		{
+			name: "full width hash",
+			text: "＃タグ",
+			facets: []want{
+				{Facet_Tag, "タグ", 0, 9},
+			},
+		},
+		{
+			name:   "tag inside a word",
+			text:   "a#b",
+			facets: nil,
+		},
+		{
+			name: "sorted by position",
+			text: "#go @a.test https://e.com",
+			facets: []want{
+				{Facet_Tag, "go", 0, 3},
+				{Facet_Mention, "a.test", 4, 11},
+				{Facet_Link, "https://e.com", 12, 25},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			facets := ParseFacets(test.text)
+			if len(facets) != len(test.facets) {
+				t.Fatalf("got %d facets %+v, want %d", len(facets), facets, len(test.facets))
+			}
+			for i, facet := range facets {
+				w := test.facets[i]
+				if facet.Ftype != w.ftype || facet.Value != w.value || facet.ByteStart != w.start || facet.ByteEnd != w.end {
+					t.Errorf("facet %d: got %v %q [%d:%d], want %v %q [%d:%d]", i, facet.Ftype, facet.Value,
+						facet.ByteStart, facet.ByteEnd, w.ftype, w.value, w.start, w.end)
+					continue
+				}
+				if got := test.text[facet.ByteStart:facet.ByteEnd]; got != facet.T_facet {
+					t.Errorf("facet %d covers %q, its text is %q", i, got, facet.T_facet)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package atlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	// MaxPostGraphemes is the max length of the text of a post accepted by the app view
+	MaxPostGraphemes = 300
+	// MaxThreadParts bounds the number of posts created from a single text
+	MaxThreadParts = 25
+)
+
+// ThreadPart is a post of a split text with the facets inside it.
+// The byte range of the facets is relative to the text of the part
+type ThreadPart struct {
+	Text   string
+	Facets []Facet
+}
+
+// GraphemeLength returns the number of user perceived characters of the text,
+// which is how the post length limit is counted
+func GraphemeLength(text string) int {
+	return uniseg.GraphemeClusterCount(text)
+}
+
+// SplitThread splits a long text into posts of at most MaxPostGraphemes graphemes. The text is cut
+// after a sentence when possible, else at a space, and never inside a facet, so the facets must
+// have their byte range. With numbering, every part of a multi-part thread ends with " i/n"
+func SplitThread(text string, facets []Facet, numbering bool) ([]ThreadPart, error) {
+	parts, err := splitThreadText(text, facets, MaxPostGraphemes)
+	if err != nil || !numbering || len(parts) == 1 {
+		return parts, err
+	}
+	// the text needs several posts, split it again with room for the " i/n" suffix
+	for digits := len(strconv.Itoa(len(parts))); ; digits++ {
+		parts, err = splitThreadText(text, facets, MaxPostGraphemes-2*digits-2)
+		if err != nil {
+			return nil, err
+		}
+		if len(strconv.Itoa(len(parts))) > digits {
+			// the suffix takes more room than expected, split again
+			continue
+		}
+		for i := range parts {
+			parts[i].Text += fmt.Sprintf(" %d/%d", i+1, len(parts))
+		}
+		return parts, nil
+	}
+}
+
+func splitThreadText(text string, facets []Facet, limit int) ([]ThreadPart, error) {
+	parts, err := splitText(text, facets, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, errors.New("thread text is empty")
+	}
+	if len(parts) > MaxThreadParts {
+		return nil, fmt.Errorf("thread is too long: %d posts, the limit is %d", len(parts), MaxThreadParts)
+	}
+	return parts, nil
+}
+
+// PostThread publishes the posts as a chain of replies, each post answering the previous one.
+// The first post can already be a reply. When a post fails, the posts already created are deleted
+func (c *BskyAgent) PostThread(ctx context.Context, builders []PostBuilder) ([]atproto.RepoStrongRef, error) {
+	// catch the invalid posts before anything is published
+	for i, builder := range builders {
+		if _, err := builder.Build(); err != nil {
+			return nil, fmt.Errorf("invalid part %d of the thread, %v", i+1, err)
+		}
+	}
+	refs := make([]atproto.RepoStrongRef, 0, len(builders))
+	var root atproto.RepoStrongRef
+	for i, builder := range builders {
+		if i > 0 {
+			builder = builder.WithReply(root, refs[i-1])
+		}
+		cid, uri, err := c.postBuilder(ctx, builder)
+		if err != nil {
+			c.rollbackThread(ctx, refs)
+			return nil, fmt.Errorf("unable to post part %d of the thread, %w", i+1, err)
+		}
+		refs = append(refs, atproto.RepoStrongRef{Uri: uri, Cid: cid})
+		if i == 0 {
+			root = refs[0]
+			if builder.Reply != nil && builder.Reply.Root != nil {
+				root = *builder.Reply.Root
+			}
+		}
+	}
+	return refs, nil
+}
+
+func (c *BskyAgent) postBuilder(ctx context.Context, builder PostBuilder) (string, string, error) {
+	post, err := builder.Build()
+	if err != nil {
+		return "", "", err
+	}
+	return c.PostToFeed(ctx, post)
+}
+
+// rollbackThread deletes the posts of a failed thread, the last one first
+func (c *BskyAgent) rollbackThread(ctx context.Context, refs []atproto.RepoStrongRef) {
+	for i := len(refs) - 1; i >= 0; i-- {
+		if err := c.DeleteRecord(ctx, refs[i].Uri); err != nil {
+			log.Printf("Unable to delete post %s of the failed thread: %v", refs[i].Uri, err)
+		}
+	}
+}
+
+func splitText(text string, facets []Facet, limit int) ([]ThreadPart, error) {
+	var parts []ThreadPart
+	pos := skipSpace(text, 0)
+	for pos < len(text) {
+		end := graphemeOffset(text, pos, limit)
+		if end < len(text) {
+			end = breakOffset(text, facets, pos, end)
+			if end <= pos {
+				return nil, errors.New("a link or mention is too long to fit in a post")
+			}
+		}
+		part := ThreadPart{
+			Text: strings.TrimRightFunc(text[pos:end], unicode.IsSpace),
+		}
+		for _, facet := range facets {
+			if facet.ByteStart >= pos && facet.ByteEnd <= pos+len(part.Text) {
+				facet.ByteStart -= pos
+				facet.ByteEnd -= pos
+				part.Facets = append(part.Facets, facet)
+			}
+		}
+		parts = append(parts, part)
+		pos = skipSpace(text, end)
+	}
+	return parts, nil
+}
+
+// graphemeOffset returns the byte offset after count graphemes from start
+func graphemeOffset(text string, start, count int) int {
+	graphemes := uniseg.NewGraphemes(text[start:])
+	for i := 0; i < count; i++ {
+		if !graphemes.Next() {
+			return len(text)
+		}
+	}
+	_, end := graphemes.Positions()
+	return start + end
+}
+
+// breakOffset returns where to cut text[start:end]: after the last sentence ending in the second
+// half, else at the last space, else at end. The cut never falls inside a facet
+func breakOffset(text string, facets []Facet, start, end int) int {
+	half := start + (end-start)/2
+	lastSpace := -1
+	for i := end; i > start; i-- {
+		if !isSpaceAt(text, i) || insideFacet(facets, i) {
+			continue
+		}
+		if lastSpace < 0 {
+			lastSpace = i
+		}
+		if i <= half {
+			break
+		}
+		last, _ := utf8.DecodeLastRuneInString(text[:i])
+		if text[i] == '\n' || strings.ContainsRune(".!?…。！？", last) {
+			return i
+		}
+	}
+	if lastSpace > start {
+		return lastSpace
+	}
+	// a single long word, cut it at a grapheme boundary before the facet it breaks
+	for _, facet := range facets {
+		if insideFacet([]Facet{facet}, end) {
+			return facet.ByteStart
+		}
+	}
+	return end
+}
+
+func isSpaceAt(text string, i int) bool {
+	if !utf8.RuneStart(text[i]) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsSpace(r)
+}
+
+func insideFacet(facets []Facet, i int) bool {
+	for _, facet := range facets {
+		if facet.ByteStart < i && i < facet.ByteEnd {
+			return true
+		}
+	}
+	return false
+}
+
+func skipSpace(text string, pos int) int {
+	for pos < len(text) {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
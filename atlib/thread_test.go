@@ -0,0 +1,183 @@
+package atlib
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// words returns a text of n graphemes made of 4 letter words separated by spaces
+func words(n int) string {
+	text := strings.Repeat("abcd ", n/5+1)
+	return text[:n]
+}
+
+func TestSplitThread(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		numbering bool
+		// suffixes are the expected endings of the parts
+		suffixes []string
+	}{
+		{"one post", words(120), true, []string{""}},
+		{"one post at the limit with numbering", words(298), true, []string{""}},
+		{"full post with numbering", words(MaxPostGraphemes), true, []string{""}},
+		{"two posts without numbering", words(MaxPostGraphemes + 1), false, []string{"", ""}},
+		{"two posts with numbering", words(MaxPostGraphemes + 1), true, []string{" 1/2", " 2/2"}},
+		{"ten posts with numbering", words(9*MaxPostGraphemes + 50), true, []string{" 1/10", " 2/10", " 3/10", " 4/10", " 5/10",
+			" 6/10", " 7/10", " 8/10", " 9/10", " 10/10"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts, err := SplitThread(test.text, nil, test.numbering)
+			if err != nil {
+				t.Fatalf("split: %v", err)
+			}
+			if len(parts) != len(test.suffixes) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(test.suffixes))
+			}
+			var joined []string
+			for i, part := range parts {
+				if GraphemeLength(part.Text) > MaxPostGraphemes {
+					t.Errorf("part %d has %d graphemes", i+1, GraphemeLength(part.Text))
+				}
+				if !strings.HasSuffix(part.Text, test.suffixes[i]) {
+					t.Errorf("part %d %q does not end with %q", i+1, part.Text, test.suffixes[i])
+				}
+				joined = append(joined, strings.TrimSuffix(part.Text, test.suffixes[i]))
+			}
+			if got := strings.Join(joined, " "); got != strings.TrimSpace(test.text) {
+				t.Errorf("the parts do not keep the text:\n%q\n%q", got, test.text)
+			}
+		})
+	}
+}
+
+func TestSplitThreadErrors(t *testing.T) {
+	if _, err := SplitThread("   ", nil, true); err == nil {
+		t.Errorf("an empty text is split")
+	}
+	if _, err := SplitThread(words((MaxThreadParts+1)*MaxPostGraphemes), nil, false); err == nil {
+		t.Errorf("a text of more than %d posts is split", MaxThreadParts)
+	}
+}
+
+func TestSplitTextFacets(t *testing.T) {
+	// the first part ends before the link, which is moved to the second part whole
+	head := words(280) + " "
+	link := "https://example.com/a/long/path"
+	text := head + link + " done"
+	linkStart := len(head)
+	facets := []Facet{
+		{Ftype: Facet_Mention, Value: "did:plc:a", T_facet: "abcd", ByteStart: 0, ByteEnd: 4},
+		{Ftype: Facet_Link, Value: link, T_facet: link, ByteStart: linkStart, ByteEnd: linkStart + len(link)},
+	}
+	parts, err := splitText(text, facets, MaxPostGraphemes)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if len(parts[0].Facets) != 1 || parts[0].Facets[0].ByteStart != 0 || parts[0].Facets[0].ByteEnd != 4 {
+		t.Errorf("unexpected facets of the first part %+v", parts[0].Facets)
+	}
+	if len(parts[1].Facets) != 1 {
+		t.Fatalf("unexpected facets of the second part %+v", parts[1].Facets)
+	}
+	facet := parts[1].Facets[0]
+	if got := parts[1].Text[facet.ByteStart:facet.ByteEnd]; got != link {
+		t.Errorf("the link facet of the second part covers %q", got)
+	}
+}
+
+func TestSplitTextMultibyte(t *testing.T) {
+	// a skin tone emoji is a single grapheme of 8 bytes, the text has no space to break at
+	emoji := "👍🏽"
+	text := strings.Repeat(emoji, MaxPostGraphemes+10)
+	parts, err := splitText(text, nil, MaxPostGraphemes)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if parts[0].Text != strings.Repeat(emoji, MaxPostGraphemes) || parts[1].Text != strings.Repeat(emoji, 10) {
+		t.Errorf("the text is not cut at a grapheme boundary: %d and %d graphemes",
+			GraphemeLength(parts[0].Text), GraphemeLength(parts[1].Text))
+	}
+	for i, part := range parts {
+		if !utf8.ValidString(part.Text) {
+			t.Errorf("part %d is not valid UTF-8", i+1)
+		}
+	}
+}
+
+func TestBreakOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		facets []Facet
+		end    int
+		want   int
+	}{
+		{
+			name: "after a sentence in the second half",
+			text: "one two three. four five",
+			end:  20,
+			want: 14,
+		},
+		{
+			name: "at a newline",
+			text: "one two three\nfour five",
+			end:  20,
+			want: 13,
+		},
+		{
+			name: "a sentence in the first half is not used",
+			text: "one. two three four five six",
+			end:  22,
+			want: 19,
+		},
+		{
+			name: "at the last space",
+			text: "one two three four five",
+			end:  16,
+			want: 13,
+		},
+		{
+			name:   "not inside a facet",
+			text:   "one two #three four",
+			facets: []Facet{{Ftype: Facet_Tag, ByteStart: 8, ByteEnd: 19}},
+			end:    17,
+			want:   7,
+		},
+		{
+			name: "a single word at the end",
+			text: "onetwothreefour",
+			end:  10,
+			want: 10,
+		},
+		{
+			name:   "a single word before the facet it breaks",
+			text:   "abc@handle.test",
+			facets: []Facet{{Ftype: Facet_Mention, ByteStart: 3, ByteEnd: 15}},
+			end:    10,
+			want:   3,
+		},
+		{
+			name: "a multibyte sentence ending",
+			text: "première phrase。 deuxième phrase",
+			end:  30,
+			want: 19,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := breakOffset(test.text, test.facets, 0, test.end); got != test.want {
+				t.Errorf("got %d (%q), want %d (%q)", got, test.text[:got], test.want, test.text[:test.want])
+			}
+		})
+	}
+}
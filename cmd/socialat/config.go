@@ -19,9 +19,17 @@ type Config struct {
 	Mail      email.Config     `yaml:"mail"`
 }
 
+// migrateSecrets runs the one-off encryption of the secret db columns instead of the web server
+var migrateSecrets bool
+
+// grantAdmin is the username of a local user made admin instead of running the web server
+var grantAdmin string
+
 func loadConfig() (*Config, error) {
 	var filePath string
 	flag.StringVar(&filePath, "config", "sample_config.yaml", "-config=<path to config file>")
+	flag.BoolVar(&migrateSecrets, "migrate-secrets", false, "-migrate-secrets encrypt secret db columns with the current aesSecretKey and exit")
+	flag.StringVar(&grantAdmin, "grant-admin", "", "-grant-admin=<username> give the admin role to a local auth user and exit")
 	flag.Parse()
 	raw, err := os.ReadFile(filePath)
 	if err != nil {
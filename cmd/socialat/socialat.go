@@ -6,6 +6,7 @@ import (
 	"socialat/be/email"
 	"socialat/be/log"
 	"socialat/be/storage"
+	"socialat/be/utils"
 	"socialat/be/webserver"
 	"time"
 )
@@ -31,11 +32,38 @@ func _main() error {
 		return fmt.Errorf("failed to init logRotator: %v", err.Error())
 	}
 
-	db, err := storage.NewStorage(conf.Db, log.GetDBLogger())
+	db, err := storage.NewStorage(conf.Db, storage.KeyConfig{
+		SecretKey:   conf.WebServer.AesSecretKey,
+		Version:     conf.WebServer.AesSecretKeyVersion,
+		RetiredKeys: conf.WebServer.AesRetiredSecretKeys,
+	}, log.GetDBLogger())
 	if err != nil {
 		return err
 	}
 
+	if migrateSecrets {
+		count, err := db.MigrateSecrets()
+		if err != nil {
+			return fmt.Errorf("migrate secrets failed: %v", err)
+		}
+		log.Log.Infof("Migrated secrets of %d rows", count)
+		return nil
+	}
+
+	// the roles of the auth microservice users are managed by the auth microservice
+	if grantAdmin != "" {
+		user, err := db.GetUserByUserName(grantAdmin)
+		if err != nil {
+			return fmt.Errorf("get local user %s failed: %v", grantAdmin, err)
+		}
+		user.Role = utils.UserRoleAdmin
+		if err = db.UpdateUser(user); err != nil {
+			return fmt.Errorf("grant admin role failed: %v", err)
+		}
+		log.Log.Infof("Granted the admin role to %s", grantAdmin)
+		return nil
+	}
+
 	mailClient, err := email.NewMailClient(conf.Mail)
 	if err != nil {
 		return err
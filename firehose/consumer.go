@@ -0,0 +1,291 @@
+package firehose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"socialat/be/atlib"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers/sequential"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+const (
+	subscribeReposPath = "/xrpc/com.atproto.sync.subscribeRepos"
+	// cursorSaveInterval is how often the cursor is saved while the stream is consumed
+	cursorSaveInterval = 5 * time.Second
+	minReconnectDelay  = time.Second
+	maxReconnectDelay  = 2 * time.Minute
+	// errFutureCursor is returned by the PDS when the cursor is ahead of its stream,
+	// which happens when the PDS was reset
+	errFutureCursor = "FutureCursor"
+)
+
+type Config struct {
+	// Enabled starts the consumer with the web server
+	Enabled bool `yaml:"enabled"`
+	// Host is the url of the PDS streaming the events, the pdsServer by default
+	Host string `yaml:"host"`
+}
+
+// CursorStore keeps the sequence number of the last handled event of a host
+type CursorStore interface {
+	GetFirehoseCursor(host string) (int64, error)
+	SaveFirehoseCursor(host string, seq int64) error
+}
+
+// Consumer subscribes to the com.atproto.sync.subscribeRepos stream of a PDS and dispatches
+// the post, like, follow and profile records of the commits to the registered handlers
+type Consumer struct {
+	host     string
+	store    CursorStore
+	seq      int64
+	savedSeq int64
+	savedAt  time.Time
+
+	postHandlers    []Handler[*PostEvent]
+	likeHandlers    []Handler[*LikeEvent]
+	followHandlers  []Handler[*FollowEvent]
+	profileHandlers []Handler[*ProfileEvent]
+}
+
+func NewConsumer(host string, store CursorStore) *Consumer {
+	return &Consumer{
+		host:  host,
+		store: store,
+	}
+}
+
+// Run consumes the stream until the context is done. The stream is resumed after the saved
+// cursor, and reconnected with a growing delay when it fails
+func (c *Consumer) Run(ctx context.Context) {
+	delay := minReconnectDelay
+	for {
+		before := c.seq
+		err := c.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if c.seq != before {
+			delay = minReconnectDelay
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		log.Warnf("firehose of %s stopped: %v, reconnecting in %v", c.host, err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+func (c *Consumer) connect(ctx context.Context) error {
+	cursor, err := c.store.GetFirehoseCursor(c.host)
+	if err != nil {
+		return fmt.Errorf("unable to load the firehose cursor, %w", err)
+	}
+	streamUrl, err := subscribeReposUrl(c.host, cursor)
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, streamUrl, nil)
+	if err != nil {
+		return fmt.Errorf("unable to dial %s, %w", streamUrl, err)
+	}
+	log.Infof("firehose connected to %s after cursor %d", c.host, cursor)
+	c.seq, c.savedSeq = cursor, cursor
+	return c.Consume(ctx, conn)
+}
+
+// Consume handles the events of the subscribeRepos websocket until the end of the stream,
+// and saves the cursor along the way. The connection is closed when it returns
+func (c *Consumer) Consume(ctx context.Context, conn *websocket.Conn) error {
+	defer c.saveCursor()
+	callbacks := &events.RepoStreamCallbacks{
+		RepoCommit: func(evt *atproto.SyncSubscribeRepos_Commit) error {
+			c.handleCommit(ctx, evt)
+			c.advance(evt.Seq)
+			return nil
+		},
+		RepoIdentity: func(evt *atproto.SyncSubscribeRepos_Identity) error {
+			c.advance(evt.Seq)
+			return nil
+		},
+		RepoAccount: func(evt *atproto.SyncSubscribeRepos_Account) error {
+			c.advance(evt.Seq)
+			return nil
+		},
+		RepoInfo: func(evt *atproto.SyncSubscribeRepos_Info) error {
+			log.Infof("firehose info from %s: %s", c.host, evt.Name)
+			return nil
+		},
+		Error: func(evt *events.ErrorFrame) error {
+			if evt.Error == errFutureCursor {
+				// start again from the live events on the next connection
+				c.seq = 0
+				c.savedSeq = -1
+			}
+			return fmt.Errorf("stream error %s: %s", evt.Error, evt.Message)
+		},
+	}
+	// the events are handled one by one in the stream goroutine, so the cursor never
+	// goes past an event which is not handled yet
+	scheduler := sequential.NewScheduler("firehose", callbacks.EventHandler)
+	err := events.HandleRepoStream(ctx, conn, scheduler, nil)
+	// the close error may be wrapped by the stream handler
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+		return nil
+	}
+	return err
+}
+
+// advance moves the cursor after a handled event, it is saved every cursorSaveInterval
+func (c *Consumer) advance(seq int64) {
+	c.seq = seq
+	if time.Since(c.savedAt) >= cursorSaveInterval {
+		c.saveCursor()
+	}
+}
+
+func (c *Consumer) saveCursor() {
+	if c.seq == c.savedSeq {
+		return
+	}
+	c.savedAt = time.Now()
+	if err := c.store.SaveFirehoseCursor(c.host, c.seq); err != nil {
+		log.Errorf("save firehose cursor %d failed: %v", c.seq, err)
+		return
+	}
+	c.savedSeq = c.seq
+}
+
+// handleCommit dispatches the records of the commit. A commit which can not be read is
+// logged and skipped, else the stream would fail on it again after reconnecting
+func (c *Consumer) handleCommit(ctx context.Context, evt *atproto.SyncSubscribeRepos_Commit) {
+	if evt.TooBig {
+		log.Warnf("firehose skips too big commit %d of %s", evt.Seq, evt.Repo)
+		return
+	}
+	rr, err := repo.ReadRepoFromCar(ctx, bytes.NewReader(evt.Blocks))
+	if err != nil {
+		log.Warnf("firehose skips commit %d of %s: %v", evt.Seq, evt.Repo, err)
+		return
+	}
+	for _, op := range evt.Ops {
+		collection, rkey, found := strings.Cut(op.Path, "/")
+		if !found {
+			continue
+		}
+		record := RecordEvent{
+			Seq:        evt.Seq,
+			Did:        evt.Repo,
+			Action:     op.Action,
+			Collection: collection,
+			Rkey:       rkey,
+			Time:       evt.Time,
+		}
+		var value cbg.CBORMarshaler
+		if op.Action != ActionDelete {
+			if op.Cid == nil {
+				continue
+			}
+			record.Cid = op.Cid.String()
+			rcid, rec, err := rr.GetRecord(ctx, op.Path)
+			if err != nil {
+				log.Warnf("firehose commit %d has no record %s: %v", evt.Seq, record.Uri(), err)
+				continue
+			}
+			if rcid != cid.Cid(*op.Cid) {
+				log.Warnf("firehose commit %d has a mismatched cid for %s", evt.Seq, record.Uri())
+				continue
+			}
+			value = rec
+		}
+		if err := c.handleRecord(ctx, record, value); err != nil {
+			log.Warnf("firehose skips %s: %v", record.Uri(), err)
+		}
+	}
+}
+
+// handleRecord dispatches the event of a record of a watched collection.
+// value is nil for a delete
+func (c *Consumer) handleRecord(ctx context.Context, record RecordEvent, value cbg.CBORMarshaler) error {
+	switch record.Collection {
+	case atlib.CollectionPost:
+		post, err := recordAs[*appbsky.FeedPost](value)
+		if err != nil {
+			return err
+		}
+		dispatch(ctx, c.postHandlers, &PostEvent{RecordEvent: record, Post: post})
+	case atlib.CollectionLike:
+		like, err := recordAs[*appbsky.FeedLike](value)
+		if err != nil {
+			return err
+		}
+		dispatch(ctx, c.likeHandlers, &LikeEvent{RecordEvent: record, Like: like})
+	case atlib.CollectionFollow:
+		follow, err := recordAs[*appbsky.GraphFollow](value)
+		if err != nil {
+			return err
+		}
+		dispatch(ctx, c.followHandlers, &FollowEvent{RecordEvent: record, Follow: follow})
+	case atlib.CollectionProfile:
+		profile, err := recordAs[*appbsky.ActorProfile](value)
+		if err != nil {
+			return err
+		}
+		dispatch(ctx, c.profileHandlers, &ProfileEvent{RecordEvent: record, Profile: profile})
+	}
+	return nil
+}
+
+func recordAs[T cbg.CBORMarshaler](value cbg.CBORMarshaler) (T, error) {
+	var record T
+	if value == nil {
+		return record, nil
+	}
+	record, ok := value.(T)
+	if !ok {
+		return record, fmt.Errorf("unexpected record type %T", value)
+	}
+	return record, nil
+}
+
+// subscribeReposUrl returns the websocket url of the stream of the host, the http(s) url of
+// the PDS. The stream starts after the cursor, or at the live events when the cursor is 0
+func subscribeReposUrl(host string, cursor int64) (string, error) {
+	hostUrl, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	switch hostUrl.Scheme {
+	case "https", "wss":
+		hostUrl.Scheme = "wss"
+	case "http", "ws":
+		hostUrl.Scheme = "ws"
+	default:
+		return "", fmt.Errorf("unsupported firehose host scheme: %s", hostUrl.Scheme)
+	}
+	hostUrl.Path = strings.TrimSuffix(hostUrl.Path, "/") + subscribeReposPath
+	hostUrl.RawQuery = ""
+	if cursor > 0 {
+		hostUrl.RawQuery = url.Values{"cursor": {strconv.FormatInt(cursor, 10)}}.Encode()
+	}
+	return hostUrl.String(), nil
+}
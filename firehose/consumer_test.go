@@ -0,0 +1,302 @@
+package firehose
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"socialat/be/atlib"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+var update = flag.Bool("update", false, "regenerate the recorded stream of testdata")
+
+// streamFixture is a recorded subscribeRepos stream, every frame is prefixed with its length
+// as an uvarint. It is regenerated with go test ./firehose -update
+var streamFixture = filepath.Join("testdata", "subscribe_repos.frames")
+
+const (
+	fixtureDid       = "did:plc:firehosefixture"
+	fixtureFollowDid = "did:plc:followedfixture"
+	fixtureLastSeq   = 6
+)
+
+type memCursorStore map[string]int64
+
+func (s memCursorStore) GetFirehoseCursor(host string) (int64, error) {
+	return s[host], nil
+}
+
+func (s memCursorStore) SaveFirehoseCursor(host string, seq int64) error {
+	s[host] = seq
+	return nil
+}
+
+func TestConsumeRecordedStream(t *testing.T) {
+	if *update {
+		writeStreamFixture(t)
+	}
+	frames := readStreamFixture(t)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != subscribeReposPath {
+			http.NotFound(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, frame := range frames {
+			if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+				return
+			}
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		// wait for the consumer to close the connection
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	store := memCursorStore{}
+	consumer := NewConsumer(server.URL, store)
+	var posts []*PostEvent
+	var likes []*LikeEvent
+	var follows []*FollowEvent
+	var profiles []*ProfileEvent
+	consumer.OnPost(func(_ context.Context, evt *PostEvent) error {
+		posts = append(posts, evt)
+		return nil
+	})
+	consumer.OnLike(func(_ context.Context, evt *LikeEvent) error {
+		likes = append(likes, evt)
+		return nil
+	})
+	consumer.OnFollow(func(_ context.Context, evt *FollowEvent) error {
+		follows = append(follows, evt)
+		return nil
+	})
+	consumer.OnProfile(func(_ context.Context, evt *ProfileEvent) error {
+		profiles = append(profiles, evt)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := consumer.connect(ctx); err != nil {
+		t.Fatalf("consume the stream: %v", err)
+	}
+
+	if len(posts) != 2 {
+		t.Fatalf("got %d post events, want 2", len(posts))
+	}
+	created, deleted := posts[0], posts[1]
+	if created.Action != ActionCreate || created.Did != fixtureDid || created.Cid == "" {
+		t.Errorf("unexpected created post event %+v", created.RecordEvent)
+	}
+	if created.Post == nil || created.Post.Text != "hello firehose" {
+		t.Errorf("unexpected created post %+v", created.Post)
+	}
+	if !deleted.IsDelete() || deleted.Post != nil || deleted.Uri() != created.Uri() {
+		t.Errorf("unexpected deleted post event %+v", deleted.RecordEvent)
+	}
+	if len(likes) != 1 || likes[0].Like.Subject.Uri != created.Uri() || likes[0].Like.Subject.Cid != created.Cid {
+		t.Errorf("unexpected like events %+v", likes)
+	}
+	if len(follows) != 1 || follows[0].Follow.Subject != fixtureFollowDid {
+		t.Errorf("unexpected follow events %+v", follows)
+	}
+	if len(profiles) != 1 || profiles[0].Action != ActionUpdate || profiles[0].Rkey != "self" ||
+		profiles[0].Profile.DisplayName == nil || *profiles[0].Profile.DisplayName != "Fixture" {
+		t.Errorf("unexpected profile events %+v", profiles)
+	}
+	if store[server.URL] != fixtureLastSeq {
+		t.Errorf("saved cursor is %d, want %d", store[server.URL], fixtureLastSeq)
+	}
+}
+
+func readStreamFixture(t *testing.T) [][]byte {
+	data, err := os.ReadFile(streamFixture)
+	if err != nil {
+		t.Fatalf("read the stream fixture: %v", err)
+	}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	var frames [][]byte
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("read the frame size: %v", err)
+		}
+		frame := make([]byte, size)
+		if _, err = io.ReadFull(reader, frame); err != nil {
+			t.Fatalf("read the frame: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// writeStreamFixture records the commits of a repo: a post, a like of the post, a follow,
+// the profile, the deletion of the post, then an identity event
+func writeStreamFixture(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	rr := repo.NewRepo(ctx, fixtureDid, bs)
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC).Format(time.RFC3339)
+	var out bytes.Buffer
+	seq := int64(0)
+	commit := func(ops ...*atproto.SyncSubscribeRepos_RepoOp) {
+		root, rev, err := rr.Commit(ctx, func(context.Context, string, []byte) ([]byte, error) {
+			return []byte("fixture signature"), nil
+		})
+		if err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		seq++
+		writeFrame(t, &out, "#commit", &atproto.SyncSubscribeRepos_Commit{
+			Seq:    seq,
+			Repo:   fixtureDid,
+			Rev:    rev,
+			Commit: lexutil.LexLink(root),
+			Blocks: carBlocks(t, ctx, bs, root),
+			Ops:    ops,
+			Blobs:  []lexutil.LexLink{},
+			Time:   now,
+		})
+		if rr, err = repo.OpenRepo(ctx, bs, root); err != nil {
+			t.Fatalf("open repo: %v", err)
+		}
+	}
+	op := func(action, path string, c cid.Cid) *atproto.SyncSubscribeRepos_RepoOp {
+		repoOp := &atproto.SyncSubscribeRepos_RepoOp{Action: action, Path: path}
+		if c.Defined() {
+			link := lexutil.LexLink(c)
+			repoOp.Cid = &link
+		}
+		return repoOp
+	}
+
+	postCid, postRkey, err := rr.CreateRecord(ctx, atlib.CollectionPost, &appbsky.FeedPost{
+		LexiconTypeID: atlib.CollectionPost,
+		Text:          "hello firehose",
+		CreatedAt:     now,
+	})
+	if err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	postPath := atlib.CollectionPost + "/" + postRkey
+	commit(op(ActionCreate, postPath, postCid))
+
+	likeCid, likeRkey, err := rr.CreateRecord(ctx, atlib.CollectionLike, &appbsky.FeedLike{
+		LexiconTypeID: atlib.CollectionLike,
+		Subject: &atproto.RepoStrongRef{
+			Uri: "at://" + fixtureDid + "/" + postPath,
+			Cid: postCid.String(),
+		},
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("create like: %v", err)
+	}
+	commit(op(ActionCreate, atlib.CollectionLike+"/"+likeRkey, likeCid))
+
+	followCid, followRkey, err := rr.CreateRecord(ctx, atlib.CollectionFollow, &appbsky.GraphFollow{
+		LexiconTypeID: atlib.CollectionFollow,
+		Subject:       fixtureFollowDid,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		t.Fatalf("create follow: %v", err)
+	}
+	commit(op(ActionCreate, atlib.CollectionFollow+"/"+followRkey, followCid))
+
+	displayName := "Fixture"
+	profilePath := atlib.CollectionProfile + "/self"
+	profileCid, err := rr.PutRecord(ctx, profilePath, &appbsky.ActorProfile{
+		LexiconTypeID: atlib.CollectionProfile,
+		DisplayName:   &displayName,
+	})
+	if err != nil {
+		t.Fatalf("put profile: %v", err)
+	}
+	commit(op(ActionUpdate, profilePath, profileCid))
+
+	if err = rr.DeleteRecord(ctx, postPath); err != nil {
+		t.Fatalf("delete post: %v", err)
+	}
+	commit(op(ActionDelete, postPath, cid.Undef))
+
+	seq++
+	writeFrame(t, &out, "#identity", &atproto.SyncSubscribeRepos_Identity{
+		Seq:  seq,
+		Did:  fixtureDid,
+		Time: now,
+	})
+	if seq != fixtureLastSeq {
+		t.Fatalf("the fixture ends at %d, want %d", seq, fixtureLastSeq)
+	}
+	if err = os.WriteFile(streamFixture, out.Bytes(), 0644); err != nil {
+		t.Fatalf("write the stream fixture: %v", err)
+	}
+}
+
+// carBlocks returns a CAR of all the blocks of the repo, the commit of a PDS only has
+// the blocks changed by the commit but the repo is read the same way. The blockstore keys
+// only keep the multihash, the repo blocks are written back with their dag-cbor cid
+func carBlocks(t *testing.T, ctx context.Context, bs blockstore.Blockstore, root cid.Cid) []byte {
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &buf); err != nil {
+		t.Fatalf("write car header: %v", err)
+	}
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatalf("list blocks: %v", err)
+	}
+	for key := range keys {
+		block, err := bs.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("get block: %v", err)
+		}
+		blockCid := cid.NewCidV1(cid.DagCBOR, key.Hash())
+		if err = carutil.LdWrite(&buf, blockCid.Bytes(), block.RawData()); err != nil {
+			t.Fatalf("write block: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeFrame(t *testing.T, out *bytes.Buffer, msgType string, body cbg.CBORMarshaler) {
+	var frame bytes.Buffer
+	header := events.EventHeader{Op: events.EvtKindMessage, MsgType: msgType}
+	if err := header.MarshalCBOR(&frame); err != nil {
+		t.Fatalf("write frame header: %v", err)
+	}
+	if err := body.MarshalCBOR(&frame); err != nil {
+		t.Fatalf("write frame body: %v", err)
+	}
+	out.Write(binary.AppendUvarint(nil, uint64(frame.Len())))
+	out.Write(frame.Bytes())
+}
@@ -0,0 +1,90 @@
+package firehose
+
+import (
+	"context"
+	"fmt"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// RecordEvent is an operation of a commit on a record of a repo
+type RecordEvent struct {
+	// Seq is the sequence number of the commit in the stream
+	Seq        int64
+	Did        string
+	Action     string
+	Collection string
+	Rkey       string
+	// Cid is the cid of the new version of the record, empty for a delete
+	Cid  string
+	Time string
+}
+
+// Uri returns the at:// uri of the record
+func (e *RecordEvent) Uri() string {
+	return fmt.Sprintf("at://%s/%s/%s", e.Did, e.Collection, e.Rkey)
+}
+
+// IsDelete reports whether the record was deleted, the record of the event is then nil
+func (e *RecordEvent) IsDelete() bool {
+	return e.Action == ActionDelete
+}
+
+type PostEvent struct {
+	RecordEvent
+	Post *appbsky.FeedPost
+}
+
+type LikeEvent struct {
+	RecordEvent
+	Like *appbsky.FeedLike
+}
+
+type FollowEvent struct {
+	RecordEvent
+	Follow *appbsky.GraphFollow
+}
+
+type ProfileEvent struct {
+	RecordEvent
+	Profile *appbsky.ActorProfile
+}
+
+// Handler is called in the consumer goroutine for every event of its type, so it must not
+// block for long. An error is logged and does not stop the stream
+type Handler[E any] func(ctx context.Context, evt E) error
+
+// OnPost registers a handler of the created, updated and deleted posts.
+// The handlers must be registered before Run
+func (c *Consumer) OnPost(handler Handler[*PostEvent]) {
+	c.postHandlers = append(c.postHandlers, handler)
+}
+
+// OnLike registers a handler of the created and deleted likes
+func (c *Consumer) OnLike(handler Handler[*LikeEvent]) {
+	c.likeHandlers = append(c.likeHandlers, handler)
+}
+
+// OnFollow registers a handler of the created and deleted follows
+func (c *Consumer) OnFollow(handler Handler[*FollowEvent]) {
+	c.followHandlers = append(c.followHandlers, handler)
+}
+
+// OnProfile registers a handler of the profile changes
+func (c *Consumer) OnProfile(handler Handler[*ProfileEvent]) {
+	c.profileHandlers = append(c.profileHandlers, handler)
+}
+
+func dispatch[E any](ctx context.Context, handlers []Handler[E], evt E) {
+	for _, handler := range handlers {
+		if err := handler(ctx, evt); err != nil {
+			log.Warnf("firehose handler of %T failed: %v", evt, err)
+		}
+	}
+}
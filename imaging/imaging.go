@@ -0,0 +1,139 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// register the decoders of the supported upload formats
+	_ "image/gif"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maxDimension is the longest side kept for an uploaded image
+	maxDimension = 2000
+	// minDimension stops the downsizing loop when the image still does not fit
+	minDimension = 200
+	// maxPixels rejects images that would take too much memory to decode
+	maxPixels = 50_000_000
+)
+
+var jpegQualities = []int{90, 80, 70, 60, 50}
+
+// Result is an image re-encoded to fit the PDS blob size limit
+type Result struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// Process decodes a JPEG, PNG, GIF or WebP image, applies its EXIF orientation, downsizes it
+// and re-encodes it so it fits in maxSize bytes. Re-encoding drops all the metadata of the
+// original file, including EXIF and GPS data. Only the first frame of an animated GIF is kept
+func Process(data []byte, maxSize int) (*Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %v", err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image is too large: %dx%d", config.Width, config.Height)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %v", err)
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	transparent := hasTransparency(img)
+	rgba := applyOrientation(resize(img, maxDimension, transparent), orientation)
+
+	for {
+		encoded, mimeType, err := encode(rgba, transparent, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if encoded != nil {
+			bounds := rgba.Bounds()
+			return &Result{
+				Data:     encoded,
+				MimeType: mimeType,
+				Width:    bounds.Dx(),
+				Height:   bounds.Dy(),
+			}, nil
+		}
+		// still too big, try again with a smaller image
+		longest := max(rgba.Bounds().Dx(), rgba.Bounds().Dy())
+		if longest <= minDimension {
+			return nil, fmt.Errorf("unable to shrink image under %d bytes", maxSize)
+		}
+		rgba = resize(rgba, longest*3/4, transparent)
+	}
+}
+
+// encode returns nil data when the image can not fit in maxSize at its current size
+func encode(img image.Image, transparent bool, maxSize int) ([]byte, string, error) {
+	var buf bytes.Buffer
+	// keep PNG for images with transparency, JPEG would turn it black
+	if transparent {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		if buf.Len() <= maxSize {
+			return buf.Bytes(), "image/png", nil
+		}
+		return nil, "", nil
+	}
+	for _, quality := range jpegQualities {
+		buf.Reset()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", err
+		}
+		if buf.Len() <= maxSize {
+			return buf.Bytes(), "image/jpeg", nil
+		}
+	}
+	return nil, "", nil
+}
+
+// resize scales the image down so its longest side is at most maxSide.
+// The image is always copied to a new RGBA image to drop paletted or YCbCr sources
+func resize(img image.Image, maxSide int, transparent bool) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			height = max(1, height*maxSide/width)
+			width = maxSide
+		} else {
+			width = max(1, width*maxSide/height)
+			height = maxSide
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if !transparent {
+		// flatten on white so a fully transparent pixel does not become black
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+		return dst
+	}
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Over, nil)
+	return dst
+}
+
+func hasTransparency(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+type ifdEntry struct {
+	tag   uint16
+	value uint16
+}
+
+// exifTiff builds the TIFF structure of an EXIF segment with a single IFD of SHORT entries
+func exifTiff(order binary.ByteOrder, entries ...ifdEntry) []byte {
+	tiff := make([]byte, 8, 8+2+len(entries)*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:4], 42)
+	order.PutUint32(tiff[4:8], 8)
+	count := make([]byte, 2)
+	order.PutUint16(count, uint16(len(entries)))
+	tiff = append(tiff, count...)
+	for _, e := range entries {
+		entry := make([]byte, 12)
+		order.PutUint16(entry[0:2], e.tag)
+		// type SHORT, count 1, the value is left justified in the 4 bytes
+		order.PutUint16(entry[2:4], 3)
+		order.PutUint32(entry[4:8], 1)
+		order.PutUint16(entry[8:10], e.value)
+		tiff = append(tiff, entry...)
+	}
+	// no next IFD
+	return append(tiff, 0, 0, 0, 0)
+}
+
+// segment returns a JPEG marker segment, its length counts the 2 length bytes
+func segment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:4], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// jpegFile returns the start of a JPEG file with the segments, up to the start of scan
+func jpegFile(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, seg := range segments {
+		data = append(data, seg...)
+	}
+	return append(data, 0xFF, 0xDA, 0x00, 0x02)
+}
+
+func exifSegment(tiff []byte) []byte {
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func TestJpegOrientation(t *testing.T) {
+	app0 := segment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	xmp := segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"no exif", jpegFile(app0), 1},
+		{"big endian", jpegFile(exifSegment(exifTiff(binary.BigEndian, ifdEntry{exifOrientationTag, 6}))), 6},
+		{"little endian", jpegFile(exifSegment(exifTiff(binary.LittleEndian, ifdEntry{exifOrientationTag, 8}))), 8},
+		{"after other tags", jpegFile(app0, exifSegment(exifTiff(binary.LittleEndian,
+			ifdEntry{0x010F, 0x4142}, ifdEntry{0x0110, 0x4344}, ifdEntry{exifOrientationTag, 3}))), 3},
+		{"after an xmp segment", jpegFile(xmp, exifSegment(exifTiff(binary.BigEndian, ifdEntry{exifOrientationTag, 5}))), 5},
+		{"missing tag", jpegFile(exifSegment(exifTiff(binary.BigEndian, ifdEntry{0x010F, 6}))), 1},
+		{"invalid value", jpegFile(exifSegment(exifTiff(binary.BigEndian, ifdEntry{exifOrientationTag, 9}))), 1},
+		{"unknown byte order", jpegFile(exifSegment(append([]byte("XX"), exifTiff(binary.BigEndian, ifdEntry{exifOrientationTag, 6})[2:]...))), 1},
+		{"truncated app1", jpegFile(exifSegment(exifTiff(binary.BigEndian, ifdEntry{exifOrientationTag, 6})))[:20], 1},
+		{"truncated ifd", jpegFile(exifSegment(exifTiff(binary.LittleEndian, ifdEntry{0x010F, 1}, ifdEntry{exifOrientationTag, 6})[:24])), 1},
+		{"ifd offset out of the segment", jpegFile(exifSegment([]byte("MM\x00\x2a\x00\x00\xff\xff"))), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := jpegOrientation(test.data); got != test.want {
+				t.Errorf("got orientation %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// letterImage returns an image with one row per string, each letter is a pixel
+func letterImage(rows ...string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			img.SetRGBA(x, y, color.RGBA{R: row[x], A: 0xFF})
+		}
+	}
+	return img
+}
+
+func letterRows(img *image.RGBA) []string {
+	bounds := img.Bounds()
+	var rows []string
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		var row []byte
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			row = append(row, img.RGBAAt(x, y).R)
+		}
+		rows = append(rows, string(row))
+	}
+	return rows
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// the upright image is
+	//   abc
+	//   def
+	// and the stored images are what a camera writes for each orientation
+	upright := []string{"abc", "def"}
+	tests := []struct {
+		orientation int
+		stored      []string
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"cf", "be", "ad"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"da", "eb", "fc"}},
+	}
+	for _, test := range tests {
+		got := letterRows(applyOrientation(letterImage(test.stored...), test.orientation))
+		if len(got) != len(upright) || got[0] != upright[0] || got[1] != upright[1] {
+			t.Errorf("orientation %d: got %q, want %q", test.orientation, got, upright)
+		}
+	}
+}
+
+func TestApplyOrientationSubImage(t *testing.T) {
+	// the bounds of a decoded image may not start at 0,0
+	img := letterImage("xxx", "xcf", "xbe", "xad").SubImage(image.Rect(1, 1, 3, 4)).(*image.RGBA)
+	got := letterRows(applyOrientation(img, 6))
+	if len(got) != 2 || got[0] != "abc" || got[1] != "def" {
+		t.Errorf("got %q, want [abc def]", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"socialat/be/firehose"
 	"socialat/be/webserver"
 	"socialat/be/webserver/service"
 
@@ -41,6 +42,7 @@ func GetDBLogger() *log.Logger {
 func initLog() {
 	webserver.UseLogger(Log)
 	service.UseLogger(Log)
+	firehose.UseLogger(Log)
 }
 
 func SetLogLevel(logLevel string) {
@@ -19,6 +19,19 @@ func (s *Sort) RequestedSort() string {
 	return s.Order
 }
 
+// Window returns the bounds of the requested page in a list of total items,
+// for the lists which are not read from the database
+func (s *Sort) Window(total int) (int, int) {
+	if s.Page <= 0 {
+		s.Page = 1
+	}
+	if s.Size <= 0 {
+		s.Size = defaultOffset
+	}
+	start := min((s.Page-1)*s.Size, total)
+	return start, min(start+s.Size, total)
+}
+
 func (s *Sort) BindQuery(db *gorm.DB) *gorm.DB {
 	if s.Page <= 0 {
 		s.Page = 1
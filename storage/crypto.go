@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// plainKeyVersion marks rows written before their secret columns were encrypted
+const plainKeyVersion = 0
+
+const dataKeySize = 32
+
+// KeyConfig is the aesSecretKey set used to encrypt secret columns.
+// Retired keys are only used to read rows that were not migrated to the current key yet
+type KeyConfig struct {
+	SecretKey   string
+	Version     int
+	RetiredKeys map[int]string
+}
+
+// keyring implements envelope encryption for secret columns: each value is sealed with
+// a random data key, and the data key is sealed with the versioned aesSecretKey.
+// Rotating aesSecretKey only needs the data keys to be re-wrapped
+type keyring struct {
+	current int
+	keks    map[int]cipher.AEAD
+}
+
+func newKeyring(conf KeyConfig) (*keyring, error) {
+	if conf.SecretKey == "" {
+		return nil, fmt.Errorf("please set up aesSecretKey")
+	}
+	version := conf.Version
+	if version <= plainKeyVersion {
+		version = 1
+	}
+	k := &keyring{
+		current: version,
+		keks:    make(map[int]cipher.AEAD),
+	}
+	for retiredVersion, secret := range conf.RetiredKeys {
+		if retiredVersion <= plainKeyVersion || retiredVersion == version {
+			return nil, fmt.Errorf("invalid retired aesSecretKey version: %d", retiredVersion)
+		}
+		aead, err := newAEAD(deriveKey(secret))
+		if err != nil {
+			return nil, err
+		}
+		k.keks[retiredVersion] = aead
+	}
+	aead, err := newAEAD(deriveKey(conf.SecretKey))
+	if err != nil {
+		return nil, err
+	}
+	k.keks[version] = aead
+	return k, nil
+}
+
+// deriveKey turns the configured secret of any length into an AES-256 key
+func deriveKey(secret string) []byte {
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+	return aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+}
+
+// encrypt seals the plain value and returns base64(wrapped data key|sealed value)
+// with the key version used to wrap the data key
+func (k *keyring) encrypt(plain string) (string, int, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", 0, err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", 0, err
+	}
+	sealedValue, err := seal(dataAEAD, []byte(plain))
+	if err != nil {
+		return "", 0, err
+	}
+	wrappedKey, err := seal(k.keks[k.current], dataKey)
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.StdEncoding.EncodeToString(append(wrappedKey, sealedValue...)), k.current, nil
+}
+
+// decrypt opens a value produced by encrypt with the given key version
+func (k *keyring) decrypt(encrypted string, version int) (string, error) {
+	if version == plainKeyVersion {
+		return encrypted, nil
+	}
+	dataKey, sealedValue, err := k.unwrap(encrypted, version)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(dataAEAD, sealedValue)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// rewrap re-seals the data key of the value with the current key version.
+// The sealed value itself is kept as is
+func (k *keyring) rewrap(encrypted string, version int) (string, int, error) {
+	if version == plainKeyVersion {
+		return k.encrypt(encrypted)
+	}
+	dataKey, sealedValue, err := k.unwrap(encrypted, version)
+	if err != nil {
+		return "", 0, err
+	}
+	wrappedKey, err := seal(k.keks[k.current], dataKey)
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.StdEncoding.EncodeToString(append(wrappedKey, sealedValue...)), k.current, nil
+}
+
+func (k *keyring) unwrap(encrypted string, version int) ([]byte, []byte, error) {
+	kek, ok := k.keks[version]
+	if !ok {
+		return nil, nil, fmt.Errorf("aesSecretKey version %d is not configured", version)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrappedSize := kek.NonceSize() + dataKeySize + kek.Overhead()
+	if len(raw) < wrappedSize {
+		return nil, nil, fmt.Errorf("encrypted value is too short")
+	}
+	dataKey, err := open(kek, raw[:wrappedSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, raw[wrappedSize:], nil
+}
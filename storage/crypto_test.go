@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, conf KeyConfig) *keyring {
+	k, err := newKeyring(conf)
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	return k
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	k := newTestKeyring(t, KeyConfig{SecretKey: "current secret", Version: 3})
+	for _, plain := range []string{"", "password", "mật khẩu 🔑", strings.Repeat("x", 4096)} {
+		encrypted, version, err := k.encrypt(plain)
+		if err != nil {
+			t.Fatalf("encrypt %q: %v", plain, err)
+		}
+		if version != 3 {
+			t.Errorf("encrypted with version %d, want 3", version)
+		}
+		if plain != "" && strings.Contains(encrypted, plain) {
+			t.Errorf("the encrypted value holds the plain text %q", plain)
+		}
+		decrypted, err := k.decrypt(encrypted, version)
+		if err != nil {
+			t.Fatalf("decrypt %q: %v", plain, err)
+		}
+		if decrypted != plain {
+			t.Errorf("got %q, want %q", decrypted, plain)
+		}
+	}
+	// every value has its own data key and nonces
+	first, _, _ := k.encrypt("password")
+	second, _, _ := k.encrypt("password")
+	if first == second {
+		t.Errorf("the same value is encrypted twice the same way")
+	}
+}
+
+func TestKeyringWrongVersion(t *testing.T) {
+	k := newTestKeyring(t, KeyConfig{
+		SecretKey:   "current secret",
+		Version:     2,
+		RetiredKeys: map[int]string{1: "retired secret"},
+	})
+	encrypted, version, err := k.encrypt("password")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err = k.decrypt(encrypted, 5); err == nil {
+		t.Errorf("a value is decrypted with a version which is not configured")
+	}
+	if _, err = k.decrypt(encrypted, version-1); err == nil {
+		t.Errorf("a value is decrypted with the retired key")
+	}
+}
+
+func TestKeyringTampered(t *testing.T) {
+	k := newTestKeyring(t, KeyConfig{SecretKey: "current secret", Version: 1})
+	encrypted, version, err := k.encrypt("password")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	wrappedSize := k.keks[version].NonceSize() + dataKeySize + k.keks[version].Overhead()
+	tests := []struct {
+		name      string
+		encrypted string
+	}{
+		{"wrapped data key", flipByte(raw, wrappedSize/2)},
+		{"sealed value", flipByte(raw, len(raw)-1)},
+		{"truncated", base64.StdEncoding.EncodeToString(raw[:wrappedSize-1])},
+		{"not base64", "%" + encrypted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if plain, err := k.decrypt(test.encrypted, version); err == nil {
+				t.Errorf("the tampered value is decrypted to %q", plain)
+			}
+		})
+	}
+}
+
+func flipByte(raw []byte, i int) string {
+	tampered := append([]byte(nil), raw...)
+	tampered[i] ^= 0xff
+	return base64.StdEncoding.EncodeToString(tampered)
+}
+
+func TestKeyringPlainVersion(t *testing.T) {
+	k := newTestKeyring(t, KeyConfig{SecretKey: "current secret", Version: 1})
+	plain, err := k.decrypt("plain password", plainKeyVersion)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if plain != "plain password" {
+		t.Errorf("got %q, want the value as is", plain)
+	}
+	// a plain text row is encrypted by the rewrap
+	encrypted, version, err := k.rewrap("plain password", plainKeyVersion)
+	if err != nil {
+		t.Fatalf("rewrap: %v", err)
+	}
+	if version != 1 || encrypted == "plain password" {
+		t.Fatalf("the plain text row is not encrypted: version %d", version)
+	}
+	if plain, err = k.decrypt(encrypted, version); err != nil || plain != "plain password" {
+		t.Errorf("got %q, %v after the rewrap", plain, err)
+	}
+}
+
+func TestKeyringRewrap(t *testing.T) {
+	oldKeys := newTestKeyring(t, KeyConfig{SecretKey: "old secret", Version: 1})
+	encrypted, version, err := oldKeys.encrypt("password")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	rotated := newTestKeyring(t, KeyConfig{
+		SecretKey:   "new secret",
+		Version:     2,
+		RetiredKeys: map[int]string{1: "old secret"},
+	})
+	rewrapped, newVersion, err := rotated.rewrap(encrypted, version)
+	if err != nil {
+		t.Fatalf("rewrap: %v", err)
+	}
+	if newVersion != 2 {
+		t.Errorf("rewrapped with version %d, want 2", newVersion)
+	}
+	// only the data key is sealed again, the sealed value is kept
+	oldRaw, _ := base64.StdEncoding.DecodeString(encrypted)
+	newRaw, _ := base64.StdEncoding.DecodeString(rewrapped)
+	wrappedSize := rotated.keks[2].NonceSize() + dataKeySize + rotated.keks[2].Overhead()
+	if string(oldRaw[wrappedSize:]) != string(newRaw[wrappedSize:]) {
+		t.Errorf("the sealed value changed with the rewrap")
+	}
+	// the retired key is not needed anymore
+	newKeys := newTestKeyring(t, KeyConfig{SecretKey: "new secret", Version: 2})
+	plain, err := newKeys.decrypt(rewrapped, newVersion)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if plain != "password" {
+		t.Errorf("got %q, want %q", plain, "password")
+	}
+	if _, err = newKeys.decrypt(encrypted, version); err == nil {
+		t.Errorf("the value of the retired key is decrypted without it")
+	}
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf KeyConfig
+	}{
+		{"no secret", KeyConfig{Version: 1}},
+		{"retired plain version", KeyConfig{SecretKey: "secret", Version: 2, RetiredKeys: map[int]string{plainKeyVersion: "old"}}},
+		{"retired current version", KeyConfig{SecretKey: "secret", Version: 2, RetiredKeys: map[int]string{2: "old"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newKeyring(test.conf); err == nil {
+				t.Errorf("the keyring is created")
+			}
+		})
+	}
+}
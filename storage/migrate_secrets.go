@@ -0,0 +1,59 @@
+package storage
+
+// MigrateSecrets encrypts the secret columns of rows written before encryption was
+// enabled and re-wraps the rows encrypted with a retired aesSecretKey version.
+// The rows of a database upgraded from the plain text version have a NULL key_version.
+// It returns the number of updated rows
+func (p *psql) MigrateSecrets() (int, error) {
+	var count int
+	var users []PdsUser
+	if err := p.db.Where("key_version IS NULL OR key_version <> ?", p.keys.current).Find(&users).Error; err != nil {
+		return count, err
+	}
+	for _, user := range users {
+		password, version, err := p.keys.rewrap(user.Password, user.KeyVersion)
+		if err != nil {
+			return count, err
+		}
+		err = p.db.Model(&PdsUser{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+			"password":    password,
+			"key_version": version,
+		}).Error
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	// unversioned sessions use the old format, drop them and let the users login to the pds again
+	result := p.db.Where("key_version IS NULL OR key_version = ?", plainKeyVersion).Delete(&PdsSession{})
+	if result.Error != nil {
+		return count, result.Error
+	}
+	count += int(result.RowsAffected)
+
+	var sessions []PdsSession
+	if err := p.db.Where("key_version <> ?", p.keys.current).Find(&sessions).Error; err != nil {
+		return count, err
+	}
+	for _, session := range sessions {
+		accessJwt, version, err := p.keys.rewrap(session.AccessJwt, session.KeyVersion)
+		if err != nil {
+			return count, err
+		}
+		refreshJwt, _, err := p.keys.rewrap(session.RefreshJwt, session.KeyVersion)
+		if err != nil {
+			return count, err
+		}
+		err = p.db.Model(&PdsSession{}).Where("id = ?", session.Id).Updates(map[string]interface{}{
+			"access_jwt":  accessJwt,
+			"refresh_jwt": refreshJwt,
+			"key_version": version,
+		}).Error
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
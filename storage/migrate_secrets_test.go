@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	oslog "log"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestStorage opens the postgres database of SOCIALAT_TEST_DB_DNS, the test is skipped without it
+func newTestStorage(t *testing.T) *psql {
+	dns := os.Getenv("SOCIALAT_TEST_DB_DNS")
+	if dns == "" {
+		t.Skip("SOCIALAT_TEST_DB_DNS is not set")
+	}
+	db, err := NewStorage(Config{Dns: dns}, KeyConfig{SecretKey: "test secret", Version: 1}, oslog.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+	return db.(*psql)
+}
+
+func TestMigrateSecretsEncryptsPlainTextRows(t *testing.T) {
+	p := newTestStorage(t)
+	suffix := time.Now().UnixNano()
+	handle := fmt.Sprintf("plain%d.test", suffix)
+	userId := uint64(suffix)
+	t.Cleanup(func() {
+		p.db.Where("handle = ?", handle).Delete(&PdsUser{})
+		p.db.Where("user_id = ?", userId).Delete(&PdsSession{})
+	})
+	// rows of the plain text version, the key_version column added by the migration is NULL
+	err := p.db.Exec(`INSERT INTO pds_users (handle, password, key_version, email, did, invite_code, created_at, updated_at)
+		VALUES (?, ?, NULL, '', '', '', now(), now())`, handle, "plain password").Error
+	if err != nil {
+		t.Fatalf("seed pds user: %v", err)
+	}
+	err = p.db.Exec(`INSERT INTO pds_sessions (user_id, did, handle, access_jwt, refresh_jwt, key_version, created_at, updated_at)
+		VALUES (?, '', ?, 'access', 'refresh', NULL, now(), now())`, userId, handle).Error
+	if err != nil {
+		t.Fatalf("seed pds session: %v", err)
+	}
+
+	count, err := p.MigrateSecrets()
+	if err != nil {
+		t.Fatalf("migrate secrets: %v", err)
+	}
+	if count < 2 {
+		t.Fatalf("migrated %d rows, want at least 2", count)
+	}
+
+	var row PdsUser
+	if err = p.db.Where("handle = ?", handle).First(&row).Error; err != nil {
+		t.Fatalf("read pds user: %v", err)
+	}
+	if row.KeyVersion != 1 {
+		t.Errorf("key version is %d, want 1", row.KeyVersion)
+	}
+	if row.Password == "plain password" {
+		t.Errorf("password is still in plain text")
+	}
+	user, err := p.GetPdsUserByHandle(handle)
+	if err != nil {
+		t.Fatalf("get pds user: %v", err)
+	}
+	if user.Password != "plain password" {
+		t.Errorf("decrypted password is %q, want %q", user.Password, "plain password")
+	}
+	var sessions int64
+	if err = p.db.Model(&PdsSession{}).Where("user_id = ?", userId).Count(&sessions).Error; err != nil {
+		t.Fatalf("count pds sessions: %v", err)
+	}
+	if sessions != 0 {
+		t.Errorf("the plain text pds session is kept")
+	}
+}
@@ -19,7 +19,14 @@ type Storage interface {
 	Count(f Filter, obj interface{}) (int64, error)
 	Delete(d DeleteFilter, obj interface{}) error
 	GetDB() *gorm.DB
+	MigrateSecrets() (int, error)
+	UserStorage
 	PdsUserStorage
+	PdsSessionStorage
+	LinkCardStorage
+	RecordRefStorage
+	FirehoseStorage
+	ReportStorage
 }
 
 type DeleteFilter interface {
@@ -35,14 +42,19 @@ type Filter interface {
 }
 
 type psql struct {
-	db *gorm.DB
+	db   *gorm.DB
+	keys *keyring
 }
 
 type Config struct {
 	Dns string `yaml:"dns"`
 }
 
-func NewStorage(c Config, oslogger *oslog.Logger) (Storage, error) {
+func NewStorage(c Config, keyConf KeyConfig, oslogger *oslog.Logger) (Storage, error) {
+	keys, err := newKeyring(keyConf)
+	if err != nil {
+		return nil, err
+	}
 	gormLog := logger.New(oslogger, logger.Config{
 		LogLevel:                  logger.Warn,
 		Colorful:                  true,
@@ -58,12 +70,13 @@ func NewStorage(c Config, oslogger *oslog.Logger) (Storage, error) {
 		return nil, err
 	}
 	return &psql{
-		db: db,
+		db:   db,
+		keys: keys,
 	}, err
 }
 
 func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(&PdsUser{})
+	return db.AutoMigrate(&User{}, &PdsUser{}, &PdsSession{}, &LinkCard{}, &LinkThumb{}, &RecordRef{}, &FirehoseCursor{}, &Report{})
 }
 
 func (p *psql) Create(obj interface{}) error {
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FirehoseStorage interface {
+	GetFirehoseCursor(host string) (int64, error)
+	SaveFirehoseCursor(host string, seq int64) error
+}
+
+// FirehoseCursor is the sequence number of the last event of the repo event stream of a host
+// handled by the firehose consumer, the stream is resumed after it on restart
+type FirehoseCursor struct {
+	Host      string    `json:"host" gorm:"primarykey"`
+	Seq       int64     `json:"seq"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GetFirehoseCursor returns 0 when the stream of the host was never consumed
+func (p *psql) GetFirehoseCursor(host string) (int64, error) {
+	var cursor FirehoseCursor
+	err := p.db.Where("host = ?", host).First(&cursor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return cursor.Seq, nil
+}
+
+func (p *psql) SaveFirehoseCursor(host string, seq int64) error {
+	return p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "host"}},
+		DoUpdates: clause.AssignmentColumns([]string{"seq", "updated_at"}),
+	}).Create(&FirehoseCursor{
+		Host:      host,
+		Seq:       seq,
+		UpdatedAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+type LinkCardStorage interface {
+	GetLinkCard(url string) (*LinkCard, error)
+	SaveLinkCard(card *LinkCard) error
+	GetLinkThumb(url, did string) (*LinkThumb, error)
+	SaveLinkThumb(thumb *LinkThumb) error
+}
+
+// LinkCard caches the preview metadata of an external link.
+// The thumbnail blobs are cached apart in LinkThumb because blobs belong to the repo of the poster
+type LinkCard struct {
+	Id          uint64    `json:"id" gorm:"primarykey"`
+	Url         string    `json:"url" gorm:"index:link_card_url_idx,unique"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageUrl    string    `json:"imageUrl"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// LinkThumb is the thumbnail of a link card uploaded to the repo of Did, for the image ImageUrl
+type LinkThumb struct {
+	Id        uint64    `json:"id" gorm:"primarykey"`
+	Url       string    `json:"url" gorm:"index:link_thumb_url_did_idx,unique"`
+	Did       string    `json:"did" gorm:"index:link_thumb_url_did_idx,unique"`
+	ImageUrl  string    `json:"imageUrl"`
+	Cid       string    `json:"cid"`
+	MimeType  string    `json:"mimeType"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (p *psql) GetLinkCard(url string) (*LinkCard, error) {
+	var card LinkCard
+	if err := p.db.Where("url = ?", url).First(&card).Error; err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// SaveLinkCard creates or refreshes the card of card.Url
+func (p *psql) SaveLinkCard(card *LinkCard) error {
+	now := time.Now()
+	card.CreatedAt = now
+	card.UpdatedAt = now
+	return p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "description", "image_url", "updated_at"}),
+	}).Create(card).Error
+}
+
+func (p *psql) GetLinkThumb(url, did string) (*LinkThumb, error) {
+	var thumb LinkThumb
+	if err := p.db.Where("url = ? AND did = ?", url, did).First(&thumb).Error; err != nil {
+		return nil, err
+	}
+	return &thumb, nil
+}
+
+// SaveLinkThumb creates or replaces the thumbnail of thumb.Url in the repo of thumb.Did
+func (p *psql) SaveLinkThumb(thumb *LinkThumb) error {
+	thumb.CreatedAt = time.Now()
+	return p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "url"}, {Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"image_url", "cid", "mime_type", "size", "created_at"}),
+	}).Create(thumb).Error
+}
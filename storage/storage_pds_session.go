@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PdsSessionStorage interface {
+	SavePdsSession(session *PdsSession) error
+	GetPdsSessionByUserId(userId uint64) (*PdsSession, error)
+	DeletePdsSession(userId uint64) error
+}
+
+// PdsSession keeps the PDS access/refresh tokens of a user on the server side.
+// The tokens are encrypted at rest with aesSecretKey
+type PdsSession struct {
+	Id         uint64    `json:"id" gorm:"primarykey"`
+	UserId     uint64    `json:"userId" gorm:"index:pds_session_user_id_idx,unique"`
+	Did        string    `json:"did"`
+	Handle     string    `json:"handle"`
+	AccessJwt  string    `json:"-"`
+	RefreshJwt string    `json:"-"`
+	KeyVersion int       `json:"-" gorm:"default:0"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// SavePdsSession creates or replaces the session of session.UserId
+func (p *psql) SavePdsSession(session *PdsSession) error {
+	var err error
+	row := *session
+	if row.AccessJwt, row.KeyVersion, err = p.keys.encrypt(session.AccessJwt); err != nil {
+		return err
+	}
+	if row.RefreshJwt, _, err = p.keys.encrypt(session.RefreshJwt); err != nil {
+		return err
+	}
+	now := time.Now()
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	err = p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"did", "handle", "access_jwt", "refresh_jwt", "key_version", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+	session.Id = row.Id
+	session.UpdatedAt = now
+	return nil
+}
+
+func (p *psql) GetPdsSessionByUserId(userId uint64) (*PdsSession, error) {
+	var session PdsSession
+	if err := p.db.Where("user_id = ?", userId).First(&session).Error; err != nil {
+		return nil, err
+	}
+	// sessions stored before the key versioning can not be read anymore,
+	// the user gets a new one on the next pds login
+	if session.KeyVersion == plainKeyVersion {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var err error
+	if session.AccessJwt, err = p.keys.decrypt(session.AccessJwt, session.KeyVersion); err != nil {
+		return nil, err
+	}
+	if session.RefreshJwt, err = p.keys.decrypt(session.RefreshJwt, session.KeyVersion); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (p *psql) DeletePdsSession(userId uint64) error {
+	return p.db.Where("user_id = ?", userId).Delete(&PdsSession{}).Error
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+type RecordRefStorage interface {
+	SaveRecordRef(ref *RecordRef) error
+	GetRecordRef(userId uint64, collection, subject string) (*RecordRef, error)
+	DeleteRecordRef(userId uint64, collection, subject string) error
+}
+
+// RecordRef keeps the uri of a record created by a user about a subject, like the like of a post,
+// so the exact record can be deleted to undo the action
+type RecordRef struct {
+	Id         uint64    `json:"id" gorm:"primarykey"`
+	UserId     uint64    `json:"userId" gorm:"index:record_ref_subject_idx,unique"`
+	Collection string    `json:"collection" gorm:"index:record_ref_subject_idx,unique"`
+	Subject    string    `json:"subject" gorm:"index:record_ref_subject_idx,unique"`
+	Did        string    `json:"did"`
+	RecordUri  string    `json:"recordUri"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SaveRecordRef creates or replaces the record of the user about the subject
+func (p *psql) SaveRecordRef(ref *RecordRef) error {
+	ref.CreatedAt = time.Now()
+	return p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "collection"}, {Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"did", "record_uri", "created_at"}),
+	}).Create(ref).Error
+}
+
+func (p *psql) GetRecordRef(userId uint64, collection, subject string) (*RecordRef, error) {
+	var ref RecordRef
+	err := p.db.Where("user_id = ? AND collection = ? AND subject = ?", userId, collection, subject).First(&ref).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (p *psql) DeleteRecordRef(userId uint64, collection, subject string) error {
+	return p.db.Where("user_id = ? AND collection = ? AND subject = ?", userId, collection, subject).Delete(&RecordRef{}).Error
+}
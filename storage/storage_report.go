@@ -0,0 +1,36 @@
+package storage
+
+import "time"
+
+const (
+	ReportSubjectAccount = "account"
+	ReportSubjectRecord  = "record"
+)
+
+type ReportStorage interface {
+	CreateReport(report *Report) error
+}
+
+// Report is a report sent by a user to the moderation service of the PDS, kept so the admins
+// can see what the community reports. ReasonType is the short name of the lexicon reason
+type Report struct {
+	Id     uint64 `json:"id" gorm:"primarykey"`
+	UserId uint64 `json:"userId" gorm:"index:report_user_id_idx"`
+	// Did is the DID of the reporter
+	Did         string `json:"did"`
+	SubjectType string `json:"subjectType"`
+	SubjectDid  string `json:"subjectDid" gorm:"index:report_subject_did_idx"`
+	// SubjectUri and SubjectCid are empty for a report of an account
+	SubjectUri string `json:"subjectUri"`
+	SubjectCid string `json:"subjectCid"`
+	ReasonType string `json:"reasonType"`
+	Reason     string `json:"reason"`
+	// PdsReportId is the id of the report in the moderation service
+	PdsReportId int64     `json:"pdsReportId"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (p *psql) CreateReport(report *Report) error {
+	report.CreatedAt = time.Now()
+	return p.db.Create(report).Error
+}
@@ -1,6 +1,12 @@
 package storage
 
-import "time"
+import (
+	"fmt"
+	"socialat/be/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 const UserFieldUName = "user_name"
 const UserFieldId = "id"
@@ -13,15 +19,43 @@ const (
 	AuthMicroservicePasskey
 )
 
+type UserStorage interface {
+	CreateUser(user *User) error
+	UpdateUser(user *User) error
+	DeleteUser(id uint64) error
+	GetUserById(id uint64) (*User, error)
+	GetUserByUserName(userName string) (*User, error)
+}
+
 type PdsUserStorage interface {
 	CreatePdsUser(user *PdsUser) error
 	UpdatePdsUser(user *PdsUser) error
+	GetPdsUserByHandle(handle string) (*PdsUser, error)
+	GetPdsUserByDid(did string) (*PdsUser, error)
+	GetPdsUsersByHandles(handles []string) ([]PdsUser, error)
 }
 
+// User is an account registered with the local username/password auth mode.
+// Deactivated users are banned by an admin and can not log in
+type User struct {
+	Id           uint64         `json:"id" gorm:"primarykey"`
+	UserName     string         `json:"userName" gorm:"index:user_user_name_idx,unique"`
+	DisplayName  string         `json:"displayName"`
+	PasswordHash string         `json:"-"`
+	Email        string         `json:"email"`
+	Role         utils.UserRole `json:"role"`
+	Deactivated  bool           `json:"deactivated"`
+	LastLoginAt  time.Time      `json:"lastLoginAt"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+}
+
+// PdsUser is the PDS account created for a user. Password is encrypted at rest with aesSecretKey
 type PdsUser struct {
 	Id         uint64    `json:"id" gorm:"primarykey"`
 	Handle     string    `json:"handle" gorm:"index:pds_user_handle_idx,unique"`
-	Password   string    `json:"password"`
+	Password   string    `json:"-"`
+	KeyVersion int       `json:"-" gorm:"default:0"`
 	Email      string    `json:"email"`
 	Did        string    `json:"did"`
 	InviteCode string    `json:"inviteCode"`
@@ -38,10 +72,94 @@ type AuthClaims struct {
 	LastLogindt int64  `json:"lastLogindt"`
 }
 
-func (p *psql) CreatePdsUser(user *PdsUser) error {
+func (p *psql) CreateUser(user *User) error {
 	return p.db.Create(user).Error
 }
 
-func (p *psql) UpdatePdsUser(user *PdsUser) error {
+func (p *psql) UpdateUser(user *User) error {
 	return p.db.Save(user).Error
 }
+
+func (p *psql) DeleteUser(id uint64) error {
+	return p.db.Delete(&User{}, id).Error
+}
+
+func (p *psql) GetUserById(id uint64) (*User, error) {
+	var user User
+	if err := p.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (p *psql) GetUserByUserName(userName string) (*User, error) {
+	var user User
+	if err := p.db.Where(UserFieldUName+" = ?", userName).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (p *psql) CreatePdsUser(user *PdsUser) error {
+	row, err := p.encryptPdsUser(user)
+	if err != nil {
+		return err
+	}
+	if err = p.db.Create(row).Error; err != nil {
+		return err
+	}
+	user.Id = row.Id
+	return nil
+}
+
+func (p *psql) UpdatePdsUser(user *PdsUser) error {
+	row, err := p.encryptPdsUser(user)
+	if err != nil {
+		return err
+	}
+	return p.db.Save(row).Error
+}
+
+func (p *psql) GetPdsUserByHandle(handle string) (*PdsUser, error) {
+	return p.getPdsUser("handle = ?", handle)
+}
+
+func (p *psql) GetPdsUserByDid(did string) (*PdsUser, error) {
+	return p.getPdsUser("did = ?", did)
+}
+
+// GetPdsUsersByHandles returns the pds users of the handles without their password
+func (p *psql) GetPdsUsersByHandles(handles []string) ([]PdsUser, error) {
+	var users []PdsUser
+	if err := p.db.Where("handle IN ?", handles).Omit("password").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// getPdsUser returns the pds user matching the query with its password decrypted
+func (p *psql) getPdsUser(query string, arg string) (*PdsUser, error) {
+	var user PdsUser
+	if err := p.db.Where(query, arg).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utils.NewError(fmt.Errorf("pds user not found"), utils.ErrorNotFound)
+		}
+		return nil, err
+	}
+	password, err := p.keys.decrypt(user.Password, user.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = password
+	return &user, nil
+}
+
+// encryptPdsUser returns a copy of the pds user with the secret columns encrypted
+func (p *psql) encryptPdsUser(user *PdsUser) (*PdsUser, error) {
+	var err error
+	row := *user
+	if row.Password, row.KeyVersion, err = p.keys.encrypt(user.Password); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
@@ -7,6 +7,16 @@ const (
 	SortASC              = 1
 	SortDESC             = 2
 	LimitOfFetchTimeline = 50
+	// MaxFetchLimit is the max page size accepted by the PDS list endpoints
+	MaxFetchLimit = 100
+	// MaxCursorLength bounds the opaque pagination cursor sent back by the client
+	MaxCursorLength = 1024
+
+	// MaxImageBlobSize is the max size of an image embedded in a post accepted by the PDS
+	MaxImageBlobSize = 1000000
+	// MaxImageUploadSize is the max size of an image uploaded by the client before it is
+	// downsized to fit MaxImageBlobSize
+	MaxImageUploadSize = 20 << 20
 )
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
@@ -31,7 +31,7 @@ func (e *Error) HttpStatus() int {
 	switch e.Code {
 	case ErrorInternalCode:
 		return http.StatusInternalServerError
-	case ErrorBadRequest, ErrorObjectExist, ErrorLoginFail, ErrorInvalidCredential, ErrorBodyRequited:
+	case ErrorBadRequest, ErrorObjectExist, ErrorInvalidCredential, ErrorBodyRequited:
 		return http.StatusBadRequest
 	case ErrorNotFound:
 		return http.StatusNotFound
@@ -39,7 +39,7 @@ func (e *Error) HttpStatus() int {
 		return http.StatusForbidden
 	case ErrorSendMailFailed:
 		return http.StatusBadGateway
-	case ErrorUnauthorized:
+	case ErrorUnauthorized, ErrorLoginFail:
 		return http.StatusUnauthorized
 	default:
 		return http.StatusInternalServerError
@@ -71,6 +71,11 @@ var LoginFail = &Error{
 	Code: ErrorLoginFail,
 }
 
+var AccountDeactivated = &Error{
+	Mess: "your account is deactivated, please contact admin",
+	Code: ErrorForbidden,
+}
+
 var InvalidCredential = &Error{
 	Mess: "your credential is invalid",
 	Code: ErrorLoginFail,
@@ -279,3 +279,13 @@ func GetHandleFromUsername(server, username string) string {
 	}
 	return fmt.Sprintf("%s.%s", username, serverName)
 }
+
+// GetUsernameFromHandle returns the username of a handle made by GetHandleFromUsername,
+// or an empty string when the handle is not on the server
+func GetUsernameFromHandle(server, handle string) string {
+	username, found := strings.CutSuffix(handle, GetHandleFromUsername(server, ""))
+	if !found {
+		return ""
+	}
+	return username
+}
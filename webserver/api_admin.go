@@ -0,0 +1,280 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"socialat/be/storage"
+	"socialat/be/utils"
+	"socialat/be/webserver/portal"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type apiAdmin struct {
+	*WebServer
+}
+
+// listReports returns a page of the reports sent by our users with the total count
+func (a *apiAdmin) listReports(w http.ResponseWriter, r *http.Request) {
+	var f portal.ReportFilter
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	var reports []storage.Report
+	if err := a.db.GetList(&f, &reports); err != nil {
+		log.Errorf("list reports failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	total, err := a.db.Count(&f, &storage.Report{})
+	if err != nil {
+		log.Errorf("count reports failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"reports": reports,
+		"total":   total,
+	})
+}
+
+// listAccounts returns a page of the PDS accounts of our users with their state on the PDS
+func (a *apiAdmin) listAccounts(w http.ResponseWriter, r *http.Request) {
+	var f portal.PdsUserFilter
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	var pdsUsers []storage.PdsUser
+	if err := a.db.GetList(&f, &pdsUsers); err != nil {
+		log.Errorf("list pds users failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	total, err := a.db.Count(&f, &storage.PdsUser{})
+	if err != nil {
+		log.Errorf("count pds users failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	accounts := make([]portal.AdminAccount, 0, len(pdsUsers))
+	dids := make([]string, 0, len(pdsUsers))
+	for _, pdsUser := range pdsUsers {
+		accounts = append(accounts, portal.AdminAccount{PdsUser: pdsUser})
+		dids = append(dids, pdsUser.Did)
+	}
+	if len(dids) > 0 {
+		ctx := context.Background()
+		adminAgent := a.newAdminAgent(ctx)
+		infos, err := adminAgent.GetAccountInfos(ctx, dids)
+		if err != nil {
+			log.Errorf("get pds account infos failed: %v", err)
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+			return
+		}
+		views := make(map[string]*atproto.AdminDefs_AccountView, len(infos))
+		for _, info := range infos {
+			views[info.Did] = info
+		}
+		for i := range accounts {
+			accounts[i].Pds = views[accounts[i].Did]
+		}
+	}
+	utils.ResponseOK(w, Map{
+		"accounts": accounts,
+		"total":    total,
+	})
+}
+
+// getAccount returns the PDS account of a user with its invite codes and moderation status
+func (a *apiAdmin) getAccount(w http.ResponseWriter, r *http.Request) {
+	pdsUser, ok := a.accountPdsUser(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	adminAgent := a.newAdminAgent(ctx)
+	info, err := adminAgent.GetAccountInfo(ctx, pdsUser.Did)
+	if err != nil {
+		log.Errorf("get pds account info of %s failed: %v", pdsUser.Did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	status, err := adminAgent.GetAccountStatus(ctx, pdsUser.Did)
+	if err != nil {
+		log.Errorf("get pds account status of %s failed: %v", pdsUser.Did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"account": portal.AdminAccount{PdsUser: *pdsUser, Pds: info},
+		"status":  status,
+	})
+}
+
+// updateAccountStatus takes down or suspends the PDS account of a user, or reverts it, and
+// deactivates the auth account while the PDS account is moderated so the ban applies on both sides
+func (a *apiAdmin) updateAccountStatus(w http.ResponseWriter, r *http.Request) {
+	pdsUser, ok := a.accountPdsUser(w, r)
+	if !ok {
+		return
+	}
+	var f portal.UpdateAccountStatusRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.Takedown == nil && f.Suspend == nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("takedown or suspend is required"), utils.ErrorBadRequest), nil)
+		return
+	}
+	var ref *string
+	if f.Ref != "" {
+		ref = &f.Ref
+	}
+	// the auth account is resolved first, so the PDS account is not changed without it
+	user, err := a.authUserOfHandle(r, pdsUser.Handle)
+	if err != nil {
+		log.Errorf("get auth account of %s failed: %v", pdsUser.Handle, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	ctx := context.Background()
+	adminAgent := a.newAdminAgent(ctx)
+	previous, err := adminAgent.GetAccountStatus(ctx, pdsUser.Did)
+	if err != nil {
+		log.Errorf("get pds account status of %s failed: %v", pdsUser.Did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if err = adminAgent.UpdateAccountStatus(ctx, pdsUser.Did, f.Takedown, f.Suspend, ref); err != nil {
+		log.Errorf("update pds account status of %s failed: %v", pdsUser.Did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	// the status is read back as the request may change only one of the attributes
+	status, err := adminAgent.GetAccountStatus(ctx, pdsUser.Did)
+	if err != nil {
+		log.Errorf("get pds account status of %s failed: %v", pdsUser.Did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	moderated := isStatusApplied(status.Takedown) || isStatusApplied(status.Deactivated)
+	if err = a.setUserActive(r, user.Id, !moderated); err != nil {
+		log.Errorf("change auth status of %s failed: %v", pdsUser.Handle, err)
+		// put the PDS account back in its previous status, so both accounts stay in sync. The revert
+		// is not the moderation action, so it is sent without its ref
+		takedown, suspend := revertedStatus(f.Takedown, previous.Takedown), revertedStatus(f.Suspend, previous.Deactivated)
+		if revertErr := adminAgent.UpdateAccountStatus(ctx, pdsUser.Did, takedown, suspend, nil); revertErr != nil {
+			log.Errorf("revert pds account status of %s failed: %v", pdsUser.Did, revertErr)
+		}
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, status)
+}
+
+// disableInviteCodes disables the invite codes, and all the invite codes of the accounts
+func (a *apiAdmin) disableInviteCodes(w http.ResponseWriter, r *http.Request) {
+	var f portal.DisableInviteCodesRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if len(f.Codes) == 0 && len(f.Accounts) == 0 {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("codes or accounts are required"), utils.ErrorBadRequest), nil)
+		return
+	}
+	for _, did := range f.Accounts {
+		if _, err = syntax.ParseDID(did); err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+	}
+	ctx := context.Background()
+	adminAgent := a.newAdminAgent(ctx)
+	if err = adminAgent.DisableInviteCodes(ctx, f.Codes, f.Accounts); err != nil {
+		log.Errorf("disable invite codes failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, nil)
+}
+
+// updateAccountEmail changes the email of the PDS account of a user and keeps the local copy in sync
+func (a *apiAdmin) updateAccountEmail(w http.ResponseWriter, r *http.Request) {
+	pdsUser, ok := a.accountPdsUser(w, r)
+	if !ok {
+		return
+	}
+	var f portal.UpdateAccountEmailRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	ctx := context.Background()
+	adminAgent := a.newAdminAgent(ctx)
+	if err = adminAgent.UpdateAccountEmail(ctx, pdsUser.Did, f.Email); err != nil {
+		log.Errorf("update pds account email of %s failed: %v", pdsUser.Did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	pdsUser.Email = f.Email
+	if err = a.db.UpdatePdsUser(pdsUser); err != nil {
+		// the email is already changed on the PDS
+		log.Warnf("save email of pds user %s failed: %v", pdsUser.Did, err)
+	}
+	utils.ResponseOK(w, pdsUser)
+}
+
+// accountPdsUser returns the PDS account of our users with the DID of the path
+func (a *apiAdmin) accountPdsUser(w http.ResponseWriter, r *http.Request) (*storage.PdsUser, bool) {
+	did, err := syntax.ParseDID(chi.URLParam(r, "did"))
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return nil, false
+	}
+	pdsUser, err := a.db.GetPdsUserByDid(did.String())
+	if err == gorm.ErrRecordNotFound {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return nil, false
+	}
+	if err != nil {
+		log.Errorf("get pds user of %s failed: %v", did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return nil, false
+	}
+	return pdsUser, true
+}
+
+// authUserOfHandle returns the auth account of the user of the PDS handle,
+// from the local user table or from the auth microservice
+func (a *apiAdmin) authUserOfHandle(r *http.Request, handle string) (*portal.AdminUser, error) {
+	username := utils.GetUsernameFromHandle(a.conf.PdsServer, handle)
+	if username == "" {
+		return nil, fmt.Errorf("no auth account for the handle %s", handle)
+	}
+	return a.getAdminUserByUserName(r, username)
+}
+
+func isStatusApplied(attr *atproto.AdminDefs_StatusAttr) bool {
+	return attr != nil && attr.Applied
+}
+
+// revertedStatus returns the previous state of an attribute changed by a status update,
+// or nil when the update left it as it is
+func revertedStatus(requested *bool, previous *atproto.AdminDefs_StatusAttr) *bool {
+	if requested == nil {
+		return nil
+	}
+	applied := isStatusApplied(previous)
+	return &applied
+}
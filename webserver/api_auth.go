@@ -11,7 +11,9 @@ import (
 	"socialat/be/webserver/portal"
 	"time"
 
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/xrpc"
+	"gorm.io/gorm"
 )
 
 type apiAuth struct {
@@ -98,108 +100,193 @@ func (a *apiAuth) login(w http.ResponseWriter, r *http.Request) {
 		utils.Response(w, http.StatusBadRequest, err, nil)
 		return
 	}
-	resData, err := a.service.LoginByPassword(r.Context(), &authpb.WithPasswordRequest{
-		Username: f.UserName,
-		Password: f.Password,
-	})
+	var tokenString string
+	var authClaim *storage.AuthClaims
+	if a.service.IsLocalAuth() {
+		tokenString, authClaim, err = a.loginLocalUser(f)
+	} else {
+		tokenString, authClaim, err = a.loginByAuthService(r.Context(), f)
+	}
 	if err != nil {
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	var data map[string]any
-	err = utils.JsonStringToObject(resData.Data, &data)
+	pdsAccount, err := a.connectPdsSession(uint64(authClaim.Id), authClaim.Username)
 	if err != nil {
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	var authClaim storage.AuthClaims
-	userClaims, userExist := data["user"]
-	token, tokenExist := data["token"]
-	if !userExist || !tokenExist {
-		utils.Response(w, http.StatusInternalServerError, fmt.Errorf("Get login token failed"), nil)
-		return
-	}
-	tokenString := token.(string)
-	err = utils.CatchObject(userClaims, &authClaim)
+	utils.ResponseOK(w, Map{
+		"token":      tokenString,
+		"loginType":  int(storage.AuthLocalUsernamePassword),
+		"userInfo":   authClaim,
+		"pdsAccount": pdsAccount,
+	})
+}
+
+func (a *apiAuth) register(w http.ResponseWriter, r *http.Request) {
+	var f portal.RegisterForm
+	err := a.parseJSONAndValidate(r, &f)
 	if err != nil {
-		utils.Response(w, http.StatusInternalServerError, err, nil)
+		utils.Response(w, http.StatusBadRequest, err, nil)
 		return
 	}
-	handle := utils.GetHandleFromUsername(a.conf.PdsServer, authClaim.Username)
-	// get pds user from db
-	pdsUser, err := a.service.GetPdsUserByHandle(handle)
+	var tokenString string
+	var authClaim *storage.AuthClaims
+	if a.service.IsLocalAuth() {
+		tokenString, authClaim, err = a.registerLocalUser(f)
+	} else {
+		tokenString, authClaim, err = a.registerByAuthService(r.Context(), f)
+	}
 	if err != nil {
-		log.Errorf("pds user not exist. %v", err)
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	// connect to pds server
-	ctx := context.Background()
-	agent := atlib.NewAgent(ctx, a.conf.PdsServer, handle, pdsUser.Password)
-	jwtOut, err := agent.Connect(ctx)
-	if err != nil {
-		log.Errorf("connect to pds server failed. %v", err)
+	// create bluesky pds account
+	pdsAccount, err := a.CreateBlueskyPdsAccount(authClaim, f.Email, f.DisplayName)
+	if err != nil {
+		// remove the local user so the username can register again
+		if a.service.IsLocalAuth() {
+			if delErr := a.db.DeleteUser(uint64(authClaim.Id)); delErr != nil {
+				log.Errorf("Delete local user %d after the pds account failed. %v", authClaim.Id, delErr)
+			}
+		}
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
+	//handler login imediately
 	utils.ResponseOK(w, Map{
-		"token":     tokenString,
-		"loginType": int(storage.AuthLocalUsernamePassword),
-		"userInfo":  authClaim,
-		"pdsJwt":    jwtOut,
+		"token":      tokenString,
+		"loginType":  int(storage.AuthLocalUsernamePassword),
+		"userInfo":   authClaim,
+		"pdsAccount": pdsAccount,
 	})
 }
 
-func (a *apiAuth) register(w http.ResponseWriter, r *http.Request) {
-	var f portal.RegisterForm
-	err := a.parseJSONAndValidate(r, &f)
+// loginByAuthService checks the username/password with the auth microservice
+func (a *apiAuth) loginByAuthService(ctx context.Context, f portal.LoginForm) (string, *storage.AuthClaims, error) {
+	resData, err := a.service.LoginByPassword(ctx, &authpb.WithPasswordRequest{
+		Username: f.UserName,
+		Password: f.Password,
+	})
 	if err != nil {
-		utils.Response(w, http.StatusBadRequest, err, nil)
-		return
+		return "", nil, err
 	}
-	resData, err := a.service.RegisterByPassword(r.Context(), &authpb.WithPasswordRequest{
+	return parseAuthServiceToken(resData)
+}
+
+// registerByAuthService creates the username/password account on the auth microservice
+func (a *apiAuth) registerByAuthService(ctx context.Context, f portal.RegisterForm) (string, *storage.AuthClaims, error) {
+	resData, err := a.service.RegisterByPassword(ctx, &authpb.WithPasswordRequest{
 		Username: f.UserName,
 		Password: f.Password,
 	})
 	if err != nil {
-		utils.Response(w, http.StatusInternalServerError, err, nil)
-		return
+		return "", nil, err
 	}
+	return parseAuthServiceToken(resData)
+}
+
+// parseAuthServiceToken reads the login token and user claims returned by the auth microservice
+func parseAuthServiceToken(resData *authpb.ResponseData) (string, *storage.AuthClaims, error) {
 	var data map[string]any
-	err = utils.JsonStringToObject(resData.Data, &data)
+	err := utils.JsonStringToObject(resData.Data, &data)
 	if err != nil {
-		utils.Response(w, http.StatusInternalServerError, err, nil)
-		return
+		return "", nil, err
 	}
 	var authClaim storage.AuthClaims
 	userClaims, userExist := data["user"]
 	token, tokenExist := data["token"]
 	if !userExist || !tokenExist {
-		utils.Response(w, http.StatusInternalServerError, fmt.Errorf("Get login token failed"), nil)
-		return
+		return "", nil, fmt.Errorf("Get login token failed")
 	}
-	tokenString := token.(string)
+	tokenString, _ := token.(string)
 	err = utils.CatchObject(userClaims, &authClaim)
 	if err != nil {
-		utils.Response(w, http.StatusInternalServerError, err, nil)
-		return
+		return "", nil, err
 	}
-	// create bluesky pds account
-	pdsJwt, err := a.CreateBlueskyPdsAccount(&authClaim, f.Email)
+	return tokenString, &authClaim, nil
+}
+
+// loginLocalUser checks the username/password against the local user table
+func (a *apiAuth) loginLocalUser(f portal.LoginForm) (string, *storage.AuthClaims, error) {
+	user, err := a.db.GetUserByUserName(f.UserName)
 	if err != nil {
-		utils.Response(w, http.StatusInternalServerError, err, nil)
-		return
+		if err == gorm.ErrRecordNotFound {
+			return "", nil, utils.LoginFail
+		}
+		log.Errorf("get local user failed. %v", err)
+		return "", nil, err
 	}
-	//handler login imediately
-	utils.ResponseOK(w, Map{
-		"token":     tokenString,
-		"loginType": int(storage.AuthLocalUsernamePassword),
-		"userInfo":  authClaim,
-		"pdsJwt":    pdsJwt,
+	if !utils.CheckPasswordHash(user.PasswordHash, f.Password) {
+		return "", nil, utils.LoginFail
+	}
+	if user.Deactivated {
+		return "", nil, utils.AccountDeactivated
+	}
+	user.LastLoginAt = time.Now()
+	if err = a.db.UpdateUser(user); err != nil {
+		log.Errorf("update last login time failed. %v", err)
+		return "", nil, err
+	}
+	return a.issueLocalToken(user)
+}
+
+// registerLocalUser creates a new account on the local user table
+func (a *apiAuth) registerLocalUser(f portal.RegisterForm) (string, *storage.AuthClaims, error) {
+	_, err := a.db.GetUserByUserName(f.UserName)
+	if err == nil {
+		return "", nil, utils.NewError(fmt.Errorf("username already exists"), utils.ErrorObjectExist)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return "", nil, err
+	}
+	passwordHash, err := utils.HashPassword(f.Password)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	user := storage.User{
+		UserName:     f.UserName,
+		DisplayName:  f.DisplayName,
+		PasswordHash: passwordHash,
+		Email:        f.Email,
+		LastLoginAt:  now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err = a.db.CreateUser(&user); err != nil {
+		log.Errorf("Create local user failed. %v", err)
+		return "", nil, err
+	}
+	return a.issueLocalToken(&user)
+}
+
+// issueLocalToken signs a login token for the local user
+func (a *apiAuth) issueLocalToken(user *storage.User) (string, *storage.AuthClaims, error) {
+	expire := time.Now().Add(time.Duration(a.conf.AliveSessionHours) * time.Hour).Unix()
+	tokenString, err := a.createToken(authClaims{
+		Id:          user.Id,
+		UserRole:    user.Role,
+		Expire:      expire,
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
 	})
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, &storage.AuthClaims{
+		Id:          int64(user.Id),
+		Username:    user.UserName,
+		LoginType:   int(storage.AuthLocalUsernamePassword),
+		Expire:      expire,
+		Role:        int(user.Role),
+		Createdt:    user.CreatedAt.Unix(),
+		LastLogindt: user.LastLoginAt.Unix(),
+	}, nil
 }
 
-func (a *apiAuth) CreateBlueskyPdsAccount(authClaim *storage.AuthClaims, email string) (*xrpc.AuthInfo, error) {
+func (a *apiAuth) CreateBlueskyPdsAccount(authClaim *storage.AuthClaims, email, displayName string) (*portal.PdsAccount, error) {
 	ctx := context.Background()
 	// create invite code
 	inviteCode, err := atlib.CreateInviteCode(ctx, a.conf.PdsServer, a.conf.PdsAdminToken)
@@ -227,12 +314,42 @@ func (a *apiAuth) CreateBlueskyPdsAccount(authClaim *storage.AuthClaims, email s
 		log.Errorf("Create Pds user on local db failed. %v", err)
 		return nil, err
 	}
-	return &xrpc.AuthInfo{
+	if displayName != "" {
+		// the account works without a profile, so a failure does not stop the registration
+		pdsAgent := atlib.NewBasicAgent(ctx, a.conf.PdsServer)
+		pdsAgent.SetClientAuth(accountRes.AccessJwt, accountRes.RefreshJwt, accountRes.Handle, accountRes.Did)
+		err = pdsAgent.UpdateProfile(ctx, func(profile *appbsky.ActorProfile) {
+			profile.DisplayName = &displayName
+		})
+		if err != nil {
+			log.Warnf("Set display name of pds account failed. %v", err)
+		}
+	}
+	return a.savePdsSession(uint64(authClaim.Id), &xrpc.AuthInfo{
 		Handle:     accountRes.Handle,
 		Did:        accountRes.Did,
 		AccessJwt:  accountRes.AccessJwt,
 		RefreshJwt: accountRes.RefreshJwt,
-	}, nil
+	})
+}
+
+// connectPdsSession logs in to the PDS account of the user and stores the new session
+func (a *apiAuth) connectPdsSession(userId uint64, username string) (*portal.PdsAccount, error) {
+	handle := utils.GetHandleFromUsername(a.conf.PdsServer, username)
+	// get pds user from db
+	pdsUser, err := a.db.GetPdsUserByHandle(handle)
+	if err != nil {
+		log.Errorf("pds user not exist. %v", err)
+		return nil, err
+	}
+	// connect to pds server
+	ctx := context.Background()
+	authInfo, err := atlib.ConnectToGetSession(ctx, a.conf.PdsServer, handle, pdsUser.Password)
+	if err != nil {
+		log.Errorf("connect to pds server failed. %v", err)
+		return nil, err
+	}
+	return a.savePdsSession(userId, authInfo)
 }
 
 func (a *apiAuth) UpdatePasskeyFinish(w http.ResponseWriter, r *http.Request) {
@@ -360,17 +477,17 @@ func (a *apiAuth) FinishPasskeyRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	// create bluesky pds account
-	pdsJwt, err := a.CreateBlueskyPdsAccount(&authClaim, email)
+	pdsAccount, err := a.CreateBlueskyPdsAccount(&authClaim, email, r.FormValue("displayName"))
 	if err != nil {
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
 	//handler login imediately
 	utils.ResponseOK(w, Map{
-		"token":     tokenString,
-		"loginType": int(storage.AuthMicroservicePasskey),
-		"userInfo":  authClaim,
-		"pdsJwt":    pdsJwt,
+		"token":      tokenString,
+		"loginType":  int(storage.AuthMicroservicePasskey),
+		"userInfo":   authClaim,
+		"pdsAccount": pdsAccount,
 	})
 }
 
@@ -431,28 +548,16 @@ func (a *apiAuth) AssertionResult(w http.ResponseWriter, r *http.Request) {
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	handle := utils.GetHandleFromUsername(a.conf.PdsServer, authClaim.Username)
-	// get pds user from db
-	pdsUser, err := a.service.GetPdsUserByHandle(handle)
+	pdsAccount, err := a.connectPdsSession(uint64(authClaim.Id), authClaim.Username)
 	if err != nil {
-		log.Errorf("pds user not exist. %v", err)
-		utils.Response(w, http.StatusInternalServerError, err, nil)
-		return
-	}
-	// connect to pds server
-	ctx := context.Background()
-	agent := atlib.NewAgent(ctx, a.conf.PdsServer, handle, pdsUser.Password)
-	jwtOut, err := agent.Connect(ctx)
-	if err != nil {
-		log.Errorf("connect to pds server failed. %v", err)
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
 	utils.ResponseOK(w, Map{
-		"token":     tokenString,
-		"loginType": int(storage.AuthMicroservicePasskey),
-		"userInfo":  authClaim,
-		"pdsJwt":    jwtOut,
+		"token":      tokenString,
+		"loginType":  int(storage.AuthMicroservicePasskey),
+		"userInfo":   authClaim,
+		"pdsAccount": pdsAccount,
 	})
 }
 
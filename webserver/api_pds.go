@@ -1,65 +1,1420 @@
 package webserver
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"socialat/be/atlib"
+	"socialat/be/imaging"
+	"socialat/be/storage"
 	"socialat/be/utils"
 	"socialat/be/webserver/portal"
+	"time"
 
-	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
 )
 
 type apiPds struct {
 	*WebServer
 }
 
+// uploadFormMemory is the part of the multipart form kept in memory, the rest goes to temp files
+const uploadFormMemory = 1 << 20
+
+var supportedImageMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
 func (a *apiPds) getPdsSession(w http.ResponseWriter, r *http.Request) {
 	claims, _ := a.credentialsInfo(r)
 	ctx := context.Background()
-	authInfo := &xrpc.AuthInfo{
-		AccessJwt:  claims.AccessJwt,
-		RefreshJwt: claims.RefreshJwt,
-		Handle:     claims.Handle,
-		Did:        claims.Did,
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	// an expired access token is refreshed by the agent
+	session, err := pdsAgent.GetSession(ctx)
+	if err == nil {
+		utils.ResponseOK(w, portal.PdsAccount{
+			Handle: session.Handle,
+			Did:    session.Did,
+		})
+		return
+	}
+	// there is no stored session or the refresh token is no longer accepted,
+	// so login again to the pds account
+	log.Warnf("get pds session failed, create new session. %v", err)
+	handle := utils.GetHandleFromUsername(a.conf.PdsServer, claims.UserName)
+	// get pds user from db
+	pdsUser, err := a.db.GetPdsUserByHandle(handle)
+	if err != nil {
+		log.Errorf("get pds user failed. %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	// connect to pds server to get new session
+	authInfo, err := atlib.ConnectToGetSession(ctx, a.conf.PdsServer, handle, pdsUser.Password)
+	if err != nil {
+		log.Errorf("create new pds session failed. %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	pdsAccount, err := a.savePdsSession(claims.Id, authInfo)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, pdsAccount)
+}
+
+func (a *apiPds) getPdsTimeline(w http.ResponseWriter, r *http.Request) {
+	var timeLineReq portal.GetTimelineRequest
+	if err := a.parseQueryAndValidate(r, &timeLineReq); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if timeLineReq.Limit == 0 {
+		timeLineReq.Limit = utils.LimitOfFetchTimeline
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+
+	timeLineOutput, err := pdsAgent.GetTimeline(ctx, timeLineReq.Cursor, timeLineReq.Limit)
+
+	if err != nil {
+		log.Errorf("get timeline failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, timeLineOutput)
+}
+
+func (a *apiPds) getAuthorFeed(w http.ResponseWriter, r *http.Request) {
+	var f portal.GetAuthorFeedRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if f.Actor == "" {
+		f.Actor = claims.Did
+	}
+	feed, err := pdsAgent.GetAuthorFeed(ctx, f.Actor, f.Filter, f.IncludePins, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get author feed of %s failed: %v", f.Actor, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, feed)
+}
+
+func (a *apiPds) getPostThread(w http.ResponseWriter, r *http.Request) {
+	var f portal.GetPostThreadRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	depth, parentHeight := int64(atlib.DefaultThreadDepth), int64(atlib.DefaultThreadParentHeight)
+	if f.Depth != nil {
+		depth = *f.Depth
+	}
+	if f.ParentHeight != nil {
+		parentHeight = *f.ParentHeight
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	thread, err := pdsAgent.GetPostThread(ctx, f.Uri, depth, parentHeight)
+	if atlib.IsNotFound(err) {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err != nil {
+		log.Errorf("get post thread of %s failed: %v", f.Uri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, thread)
+}
+
+func (a *apiPds) getPosts(w http.ResponseWriter, r *http.Request) {
+	var f portal.GetPostsRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	// the posts not found are missing from the output
+	posts, err := pdsAgent.GetPosts(ctx, f.Uris)
+	if err != nil {
+		log.Errorf("get posts failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, posts)
+}
+
+func (a *apiPds) createPost(w http.ResponseWriter, r *http.Request) {
+	var f portal.CreatePostRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	post, err := a.buildPost(ctx, &pdsAgent, f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	cid, uri, err := pdsAgent.PostToFeed(ctx, post)
+	if err != nil {
+		log.Errorf("create post failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.CreatePostResponse{
+		Uri: uri,
+		Cid: cid,
+	})
+}
+
+// editPost rewrites a post of the session user with the body of a new post.
+// The reply of a post can not be changed, the original one is kept
+func (a *apiPds) editPost(w http.ResponseWriter, r *http.Request) {
+	rkey, ok := recordRkey(w, r)
+	if !ok {
+		return
+	}
+	var f portal.CreatePostRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.ReplyTo != "" {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("the reply of a post can not be edited"), utils.ErrorBadRequest), nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	post, err := a.buildPost(ctx, &pdsAgent, f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	// the agent writes to the repo of the session DID, so only an own post can be edited
+	cid, uri, err := pdsAgent.EditPost(ctx, rkey, post)
+	if atlib.IsRecordNotFound(err) {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err != nil {
+		log.Errorf("edit post %s failed: %v", rkey, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.CreatePostResponse{
+		Uri: uri,
+		Cid: cid,
+	})
+}
+
+func (a *apiPds) deletePost(w http.ResponseWriter, r *http.Request) {
+	rkey, ok := recordRkey(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	// the agent deletes from the repo of the session DID, so only an own post can be deleted
+	err := pdsAgent.DeletePost(ctx, rkey)
+	if atlib.IsRecordNotFound(err) {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
 	}
-	err := atlib.HandlerValidSession(ctx, a.conf.PdsServer, authInfo)
-	// if get pdf session successfully
 	if err != nil {
-		// get pds user
-		handle := utils.GetHandleFromUsername(a.conf.PdsServer, claims.UserName)
-		// get pds user from db
-		pdsUser, err := a.service.GetPdsUserByHandle(handle)
+		log.Errorf("delete post %s failed: %v", rkey, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{
+		Uri: fmt.Sprintf("at://%s/%s/%s", claims.Did, atlib.CollectionPost, rkey),
+	})
+}
+
+// recordRkey reads the record key of a record of the session repo from the url
+func recordRkey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	rkey, err := syntax.ParseRecordKey(chi.URLParam(r, "rkey"))
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return "", false
+	}
+	return rkey.String(), true
+}
+
+// buildPost builds the post of a create or edit request: it detects the facets when the client
+// does not send them, resolves the reply and quote references and unfurls the link card
+func (a *apiPds) buildPost(ctx context.Context, pdsAgent *atlib.BskyAgent, f portal.CreatePostRequest) (appbsky.FeedPost, error) {
+	postBuilder, err := newPostBuilder(f)
+	if err != nil {
+		return appbsky.FeedPost{}, err
+	}
+	// detect the mentions, links and hashtags when the client does not send the facets
+	if len(f.Facets) == 0 {
+		postBuilder = postBuilder.WithFacets(pdsAgent.DetectFacets(ctx, f.Text))
+	}
+	if f.ReplyTo != "" {
+		replyRef, err := pdsAgent.GetReplyRef(ctx, f.ReplyTo)
 		if err != nil {
-			log.Errorf("get pds user failed. %v", err)
-			utils.Response(w, http.StatusInternalServerError, err, nil)
-			return
+			return appbsky.FeedPost{}, utils.NewError(err, utils.ErrorBadRequest)
+		}
+		postBuilder = postBuilder.WithReply(*replyRef.Root, *replyRef.Parent)
+	}
+	if f.QuoteUri != "" {
+		quoteRef, err := pdsAgent.GetRecordRef(ctx, f.QuoteUri)
+		if err != nil {
+			return appbsky.FeedPost{}, utils.NewError(err, utils.ErrorBadRequest)
 		}
-		// connect to pds server to get new session
-		authInfo, err = atlib.ConnectToGetSession(ctx, a.conf.PdsServer, handle, pdsUser.Password)
+		postBuilder = postBuilder.WithQuote(*quoteRef)
+	}
+	if link := linkToUnfurl(f, postBuilder); link != "" {
+		card, err := a.unfurlLink(ctx, pdsAgent, link)
+		if err != nil {
+			// the post is still created, only without the preview card
+			log.Warnf("unfurl link %s failed: %v", link, err)
+		} else {
+			postBuilder = postBuilder.WithExternalLink(card.Title, card.Uri, card.Description, card.Thumb)
+		}
+	}
+	return postBuilder.Build()
+}
+
+// newPostBuilder maps the create post request to the atlib post builder
+func newPostBuilder(f portal.CreatePostRequest) (atlib.PostBuilder, error) {
+	postBuilder := atlib.NewPostBuilder(f.Text)
+	for _, facet := range f.Facets {
+		facetType, err := atlib.ParseFacetType(facet.Type)
+		if err != nil {
+			return postBuilder, utils.NewError(err, utils.ErrorBadRequest)
+		}
+		postBuilder = postBuilder.WithFacet(facetType, facet.Value, facet.Text)
+	}
+	if f.Link != nil {
+		link, err := url.Parse(f.Link.Uri)
+		if err != nil {
+			return postBuilder, utils.NewError(err, utils.ErrorBadRequest)
+		}
+		var thumb lexutil.LexBlob
+		if f.Link.Thumb != nil {
+			thumb = *f.Link.Thumb
+		}
+		postBuilder = postBuilder.WithExternalLink(f.Link.Title, *link, f.Link.Description, thumb)
+	}
+	if len(f.Images) > 0 {
+		blobs := make([]lexutil.LexBlob, len(f.Images))
+		images := make([]atlib.Image, len(f.Images))
+		for i, img := range f.Images {
+			if !img.Image.Ref.Defined() {
+				return postBuilder, utils.NewError(fmt.Errorf("image %d is not an uploaded blob", i), utils.ErrorBadRequest)
+			}
+			blobs[i] = img.Image
+			images[i] = atlib.Image{Title: img.Alt}
+			if img.AspectRatio != nil {
+				images[i].Width = img.AspectRatio.Width
+				images[i].Height = img.AspectRatio.Height
+			}
+		}
+		postBuilder = postBuilder.WithImages(blobs, images)
+	}
+	return postBuilder, nil
+}
+
+// linkToUnfurl returns the link of the preview card to build: the link sent without metadata,
+// or the first link of the text when the post has no embed
+func linkToUnfurl(f portal.CreatePostRequest, postBuilder atlib.PostBuilder) string {
+	if f.DisableLinkCard || len(f.Images) > 0 {
+		return ""
+	}
+	if f.Link != nil {
+		if f.Link.Title == "" && f.Link.Thumb == nil {
+			return f.Link.Uri
+		}
+		return ""
+	}
+	return firstLink(postBuilder)
+}
+
+func firstLink(postBuilder atlib.PostBuilder) string {
+	for _, facet := range postBuilder.Facet {
+		if facet.Ftype == atlib.Facet_Link {
+			return facet.Value
+		}
+	}
+	return ""
+}
+
+func (a *apiPds) createThread(w http.ResponseWriter, r *http.Request) {
+	var f portal.CreateThreadRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	parts, err := atlib.SplitThread(f.Text, pdsAgent.DetectFacets(ctx, f.Text), f.Numbering)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	builders := make([]atlib.PostBuilder, len(parts))
+	for i, part := range parts {
+		builders[i] = atlib.NewPostBuilder(part.Text).WithFacets(part.Facets)
+		if link := firstLink(builders[i]); link != "" {
+			card, err := a.unfurlLink(ctx, &pdsAgent, link)
+			if err != nil {
+				log.Warnf("unfurl link %s failed: %v", link, err)
+			} else {
+				builders[i] = builders[i].WithExternalLink(card.Title, card.Uri, card.Description, card.Thumb)
+			}
+		}
+	}
+	if f.ReplyTo != "" {
+		replyRef, err := pdsAgent.GetReplyRef(ctx, f.ReplyTo)
 		if err != nil {
-			log.Errorf("create new pds session failed. %v", err)
-			utils.Response(w, http.StatusInternalServerError, err, nil)
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
 			return
 		}
+		builders[0] = builders[0].WithReply(*replyRef.Root, *replyRef.Parent)
+	}
+	refs, err := pdsAgent.PostThread(ctx, builders)
+	if err != nil {
+		log.Errorf("create thread failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	res := portal.CreateThreadResponse{
+		Posts: make([]portal.CreatePostResponse, len(refs)),
+	}
+	for i, ref := range refs {
+		res.Posts[i] = portal.CreatePostResponse{
+			Uri: ref.Uri,
+			Cid: ref.Cid,
+		}
 	}
-	utils.ResponseOK(w, authInfo)
+	utils.ResponseOK(w, res)
 }
 
-func (a *apiPds) getPdsTimeline(w http.ResponseWriter, r *http.Request) {
-	var timeLineReq portal.GetTimelineRequest
-	a.parseJSONAndValidate(r, &timeLineReq)
+func (a *apiPds) uploadBlob(w http.ResponseWriter, r *http.Request) {
+	// leave some room for the multipart headers
+	r.Body = http.MaxBytesReader(w, r.Body, utils.MaxImageUploadSize+uploadFormMemory)
+	if err := r.ParseMultipartForm(uploadFormMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = fmt.Errorf("file must be smaller than %d bytes", utils.MaxImageUploadSize)
+		}
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	defer file.Close()
+	if header.Size > utils.MaxImageUploadSize {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("file must be smaller than %d bytes", utils.MaxImageUploadSize), utils.ErrorBadRequest), nil)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	// detect the MIME type from the content instead of trusting the client
+	mimeType := http.DetectContentType(data)
+	if !supportedImageMimeTypes[mimeType] {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("unsupported file type: %s", mimeType), utils.ErrorBadRequest), nil)
+		return
+	}
+	// strip the metadata and downsize the image to the PDS limit
+	processed, err := imaging.Process(data, utils.MaxImageBlobSize)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	blob, err := pdsAgent.UploadBlob(ctx, bytes.NewReader(processed.Data), processed.MimeType)
+	if err != nil {
+		log.Errorf("upload blob failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.UploadBlobResponse{
+		Blob: blob,
+		AspectRatio: &portal.AspectRatio{
+			Width:  int64(processed.Width),
+			Height: int64(processed.Height),
+		},
+	})
+}
+
+func (a *apiPds) like(w http.ResponseWriter, r *http.Request) {
+	a.createSubjectRecord(w, r, atlib.CollectionLike)
+}
+
+func (a *apiPds) unlike(w http.ResponseWriter, r *http.Request) {
+	a.deleteSubjectRecord(w, r, atlib.CollectionLike)
+}
+
+func (a *apiPds) repost(w http.ResponseWriter, r *http.Request) {
+	a.createSubjectRecord(w, r, atlib.CollectionRepost)
+}
+
+func (a *apiPds) unrepost(w http.ResponseWriter, r *http.Request) {
+	a.deleteSubjectRecord(w, r, atlib.CollectionRepost)
+}
+
+// createSubjectRecord likes or reposts a post and keeps the uri of the created record for the undo
+func (a *apiPds) createSubjectRecord(w http.ResponseWriter, r *http.Request, collection string) {
+	var f portal.SubjectRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
 	claims, _ := a.credentialsInfo(r)
 	ctx := context.Background()
-	pdsAgent := atlib.NewBasicAgent(ctx, a.conf.PdsServer)
-	pdsAgent.SetClientAuth(claims.AccessJwt, claims.RefreshJwt, claims.Handle, claims.Did)
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	// already done, the same record is returned
+	ref, err := a.liveRecordRef(ctx, &pdsAgent, claims.Id, collection, f.Uri)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if ref != nil {
+		utils.ResponseOK(w, portal.RecordResponse{Uri: ref.RecordUri})
+		return
+	}
+	subject := atproto.RepoStrongRef{Uri: f.Uri, Cid: f.Cid}
+	if subject.Cid == "" {
+		ref, err := pdsAgent.GetRecordRef(ctx, f.Uri)
+		if err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+		subject = *ref
+	}
+	var recordUri string
+	if collection == atlib.CollectionLike {
+		recordUri, err = pdsAgent.Like(ctx, subject)
+	} else {
+		recordUri, err = pdsAgent.Repost(ctx, subject)
+	}
+	if err != nil {
+		log.Errorf("create %s record failed: %v", collection, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	err = a.db.SaveRecordRef(&storage.RecordRef{
+		UserId:     claims.Id,
+		Collection: collection,
+		Subject:    f.Uri,
+		Did:        claims.Did,
+		RecordUri:  recordUri,
+	})
+	if err != nil {
+		// the undo can still find the record from the viewer state of the post
+		log.Warnf("save %s record ref failed: %v", collection, err)
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: recordUri})
+}
 
-	timeLineOutput, err := pdsAgent.GetTimeline(ctx, "", int64(utils.LimitOfFetchTimeline))
+// liveRecordRef returns the stored record of the user about the subject, or nil when there is none.
+// A record deleted by another client leaves a stale ref behind, which is removed
+func (a *apiPds) liveRecordRef(ctx context.Context, pdsAgent *atlib.BskyAgent, userId uint64, collection, subject string) (*storage.RecordRef, error) {
+	ref, err := a.db.GetRecordRef(userId, collection, subject)
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("get %s record ref failed: %v", collection, err)
+		return nil, err
+	}
+	_, err = pdsAgent.GetRecord(ctx, ref.RecordUri)
+	if err == nil {
+		return ref, nil
+	}
+	if !atlib.IsRecordNotFound(err) {
+		log.Errorf("check %s record %s failed: %v", collection, ref.RecordUri, err)
+		return nil, err
+	}
+	if err = a.db.DeleteRecordRef(userId, collection, subject); err != nil {
+		log.Warnf("delete stale %s record ref failed: %v", collection, err)
+	}
+	return nil, nil
+}
 
+// deleteSubjectRecord deletes the like or repost of a post. The record created by another client
+// is not stored, it is found from the viewer state of the post
+func (a *apiPds) deleteSubjectRecord(w http.ResponseWriter, r *http.Request, collection string) {
+	var f portal.SubjectQuery
+	err := a.parseQueryAndValidate(r, &f)
 	if err != nil {
-		log.Errorf("get timeline failed: %v", err)
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	var recordUri string
+	ref, err := a.db.GetRecordRef(claims.Id, collection, f.Uri)
+	if err == nil {
+		recordUri = ref.RecordUri
+	} else if err != gorm.ErrRecordNotFound {
+		log.Errorf("get %s record ref failed: %v", collection, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	} else {
+		viewer, err := pdsAgent.GetViewerState(ctx, f.Uri)
+		if err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+		if collection == atlib.CollectionLike && viewer.Like != nil {
+			recordUri = *viewer.Like
+		} else if collection == atlib.CollectionRepost && viewer.Repost != nil {
+			recordUri = *viewer.Repost
+		}
+	}
+	if recordUri == "" {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err = pdsAgent.DeleteRecord(ctx, recordUri); err != nil {
+		log.Errorf("delete %s record failed: %v", collection, err)
 		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	utils.ResponseOK(w, timeLineOutput)
+	if err = a.db.DeleteRecordRef(claims.Id, collection, f.Uri); err != nil {
+		log.Warnf("delete %s record ref failed: %v", collection, err)
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: recordUri})
+}
+
+func (a *apiPds) follow(w http.ResponseWriter, r *http.Request) {
+	a.createActorRecord(w, r, atlib.CollectionFollow)
+}
+
+func (a *apiPds) unfollow(w http.ResponseWriter, r *http.Request) {
+	a.deleteActorRecord(w, r, atlib.CollectionFollow)
+}
+
+func (a *apiPds) block(w http.ResponseWriter, r *http.Request) {
+	a.createActorRecord(w, r, atlib.CollectionBlock)
+}
+
+func (a *apiPds) unblock(w http.ResponseWriter, r *http.Request) {
+	a.deleteActorRecord(w, r, atlib.CollectionBlock)
+}
+
+// createActorRecord follows or blocks an actor and keeps the uri of the created record for the undo
+func (a *apiPds) createActorRecord(w http.ResponseWriter, r *http.Request, collection string) {
+	var f portal.ActorRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	did, err := pdsAgent.ResolveDid(ctx, f.Actor)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	// already done, the same record is returned
+	ref, err := a.liveRecordRef(ctx, &pdsAgent, claims.Id, collection, did)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if ref != nil {
+		utils.ResponseOK(w, portal.RecordResponse{Uri: ref.RecordUri})
+		return
+	}
+	var recordUri string
+	if collection == atlib.CollectionFollow {
+		recordUri, err = pdsAgent.Follow(ctx, did)
+	} else {
+		recordUri, err = pdsAgent.Block(ctx, did)
+	}
+	if err != nil {
+		log.Errorf("create %s record of %s failed: %v", collection, did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	err = a.db.SaveRecordRef(&storage.RecordRef{
+		UserId:     claims.Id,
+		Collection: collection,
+		Subject:    did,
+		Did:        claims.Did,
+		RecordUri:  recordUri,
+	})
+	if err != nil {
+		log.Warnf("save %s record ref failed: %v", collection, err)
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: recordUri})
+}
+
+// deleteActorRecord deletes the follow or block record of the actor. A record created by another
+// client is found from the viewer state of the actor profile
+func (a *apiPds) deleteActorRecord(w http.ResponseWriter, r *http.Request, collection string) {
+	var f portal.ActorQuery
+	err := a.parseQueryAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	did, err := pdsAgent.ResolveDid(ctx, f.Actor)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	var recordUri string
+	ref, err := a.db.GetRecordRef(claims.Id, collection, did)
+	if err == nil {
+		recordUri = ref.RecordUri
+	} else if err != gorm.ErrRecordNotFound {
+		log.Errorf("get %s record ref failed: %v", collection, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	} else {
+		profile, err := pdsAgent.GetProfile(ctx, did)
+		if err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+		if viewer := profile.Viewer; viewer != nil {
+			if collection == atlib.CollectionFollow && viewer.Following != nil {
+				recordUri = *viewer.Following
+			} else if collection == atlib.CollectionBlock && viewer.Blocking != nil {
+				recordUri = *viewer.Blocking
+			}
+		}
+	}
+	if recordUri == "" {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err = pdsAgent.DeleteRecord(ctx, recordUri); err != nil {
+		log.Errorf("delete %s record of %s failed: %v", collection, did, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if err = a.db.DeleteRecordRef(claims.Id, collection, did); err != nil {
+		log.Warnf("delete %s record ref failed: %v", collection, err)
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: recordUri})
+}
+
+func (a *apiPds) getFollowers(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.parseGraphRequest(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if f.Actor == "" {
+		f.Actor = claims.Did
+	}
+	followers, err := pdsAgent.GetFollowers(ctx, f.Actor, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get followers failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, followers)
+}
+
+func (a *apiPds) getFollows(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.parseGraphRequest(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if f.Actor == "" {
+		f.Actor = claims.Did
+	}
+	follows, err := pdsAgent.GetFollows(ctx, f.Actor, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get follows failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, follows)
+}
+
+func (a *apiPds) parseGraphRequest(w http.ResponseWriter, r *http.Request) (*portal.GetGraphRequest, bool) {
+	var f portal.GetGraphRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return nil, false
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	return &f, true
+}
+
+func (a *apiPds) getProfile(w http.ResponseWriter, r *http.Request) {
+	actor := chi.URLParam(r, "actor")
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	profile, err := pdsAgent.GetProfile(ctx, actor)
+	if err != nil {
+		log.Errorf("get profile of %s failed: %v", actor, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, profile)
+}
+
+func (a *apiPds) updateProfile(w http.ResponseWriter, r *http.Request) {
+	var f portal.UpdateProfileRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	for _, blob := range []*lexutil.LexBlob{f.Avatar, f.Banner} {
+		if blob == nil {
+			continue
+		}
+		// the profile lexicon only accepts png and jpeg images
+		if !blob.Ref.Defined() || (blob.MimeType != "image/png" && blob.MimeType != "image/jpeg") {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("avatar and banner must be uploaded png or jpeg blobs"), utils.ErrorBadRequest), nil)
+			return
+		}
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	err = pdsAgent.UpdateProfile(ctx, func(profile *appbsky.ActorProfile) {
+		if f.DisplayName != nil {
+			profile.DisplayName = f.DisplayName
+		}
+		if f.Description != nil {
+			profile.Description = f.Description
+		}
+		if f.Avatar != nil || f.RemoveAvatar {
+			profile.Avatar = f.Avatar
+		}
+		if f.Banner != nil || f.RemoveBanner {
+			profile.Banner = f.Banner
+		}
+	})
+	if err != nil {
+		log.Errorf("update profile failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	profile, err := pdsAgent.GetProfile(ctx, claims.Did)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, profile)
+}
+
+func (a *apiPds) listNotifications(w http.ResponseWriter, r *http.Request) {
+	var f portal.ListNotificationsRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	notifications, err := pdsAgent.ListNotifications(ctx, f.Cursor, f.Limit, f.Reasons)
+	if err != nil {
+		log.Errorf("list notifications failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, notifications)
+}
+
+func (a *apiPds) getUnreadCount(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	count, err := pdsAgent.GetUnreadCount(ctx)
+	if err != nil {
+		log.Errorf("get unread notification count failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.UnreadCountResponse{Count: count})
+}
+
+func (a *apiPds) updateSeen(w http.ResponseWriter, r *http.Request) {
+	var f portal.UpdateSeenRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	seenAt := time.Now()
+	if f.SeenAt != nil {
+		seenAt = *f.SeenAt
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if err = pdsAgent.UpdateSeen(ctx, seenAt); err != nil {
+		log.Errorf("update seen notifications failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"seenAt": seenAt,
+	})
+}
+
+func (a *apiPds) searchActors(w http.ResponseWriter, r *http.Request) {
+	var f portal.SearchActorsRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	var actors interface{}
+	var err error
+	if f.Typeahead {
+		actors, err = pdsAgent.SearchActorsTypeahead(ctx, f.Query, f.Limit)
+	} else {
+		actors, err = pdsAgent.SearchActors(ctx, f.Query, f.Cursor, f.Limit)
+	}
+	if err != nil {
+		log.Errorf("search actors failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, actors)
+}
+
+func (a *apiPds) searchPosts(w http.ResponseWriter, r *http.Request) {
+	var f portal.SearchPostsRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	posts, err := pdsAgent.SearchPosts(ctx, atlib.SearchPostsParams{
+		Query:    f.Query,
+		Sort:     f.Sort,
+		Since:    f.Since,
+		Until:    f.Until,
+		Author:   f.Author,
+		Mentions: f.Mentions,
+		Lang:     f.Lang,
+		Tags:     f.Tags,
+		Cursor:   f.Cursor,
+		Limit:    f.Limit,
+	})
+	if err != nil {
+		log.Errorf("search posts failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, posts)
+}
+
+func (a *apiPds) muteActor(w http.ResponseWriter, r *http.Request) {
+	var f portal.ActorRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if err = pdsAgent.MuteActor(ctx, f.Actor); err != nil {
+		log.Errorf("mute %s failed: %v", f.Actor, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"actor": f.Actor,
+	})
+}
+
+func (a *apiPds) unmuteActor(w http.ResponseWriter, r *http.Request) {
+	var f portal.ActorQuery
+	err := a.parseQueryAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if err = pdsAgent.UnmuteActor(ctx, f.Actor); err != nil {
+		log.Errorf("unmute %s failed: %v", f.Actor, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"actor": f.Actor,
+	})
+}
+
+func (a *apiPds) getMutes(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.parsePageRequest(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	mutes, err := pdsAgent.GetMutes(ctx, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get mutes failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, mutes)
+}
+
+func (a *apiPds) getBlocks(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.parsePageRequest(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	blocks, err := pdsAgent.GetBlocks(ctx, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get blocks failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, blocks)
+}
+
+func (a *apiPds) parsePageRequest(w http.ResponseWriter, r *http.Request) (*portal.PageRequest, bool) {
+	var f portal.PageRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return nil, false
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	return &f, true
+}
+
+func (a *apiPds) muteThread(w http.ResponseWriter, r *http.Request) {
+	var f portal.ThreadRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if err = pdsAgent.MuteThread(ctx, f.Uri); err != nil {
+		log.Errorf("mute thread %s failed: %v", f.Uri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: f.Uri})
+}
+
+func (a *apiPds) unmuteThread(w http.ResponseWriter, r *http.Request) {
+	var f portal.SubjectQuery
+	err := a.parseQueryAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if err = pdsAgent.UnmuteThread(ctx, f.Uri); err != nil {
+		log.Errorf("unmute thread %s failed: %v", f.Uri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: f.Uri})
+}
+
+func (a *apiPds) createList(w http.ResponseWriter, r *http.Request) {
+	var f portal.CreateListRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	purpose := atlib.ListPurposeModeration
+	if f.Purpose == "curatelist" {
+		purpose = atlib.ListPurposeCuration
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	uri, err := pdsAgent.CreateList(ctx, purpose, f.Name, f.Description)
+	if err != nil {
+		log.Errorf("create list failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: uri})
+}
+
+func (a *apiPds) updateList(w http.ResponseWriter, r *http.Request) {
+	rkey, ok := recordRkey(w, r)
+	if !ok {
+		return
+	}
+	var f portal.UpdateListRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	// the agent writes to the repo of the session DID, so only an own list can be updated
+	uri, err := pdsAgent.UpdateList(ctx, rkey, func(list *appbsky.GraphList) {
+		if f.Name != nil {
+			list.Name = *f.Name
+		}
+		if f.Description != nil {
+			list.Description = f.Description
+		}
+	})
+	if atlib.IsRecordNotFound(err) {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err != nil {
+		log.Errorf("update list %s failed: %v", rkey, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: uri})
+}
+
+func (a *apiPds) deleteList(w http.ResponseWriter, r *http.Request) {
+	rkey, ok := recordRkey(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	err := pdsAgent.DeleteList(ctx, rkey)
+	if atlib.IsRecordNotFound(err) {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err != nil {
+		log.Errorf("delete list %s failed: %v", rkey, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{
+		Uri: fmt.Sprintf("at://%s/%s/%s", claims.Did, atlib.CollectionList, rkey),
+	})
+}
+
+func (a *apiPds) getLists(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.parseGraphRequest(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	if f.Actor == "" {
+		f.Actor = claims.Did
+	}
+	lists, err := pdsAgent.GetLists(ctx, f.Actor, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get lists of %s failed: %v", f.Actor, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, lists)
+}
+
+func (a *apiPds) getList(w http.ResponseWriter, r *http.Request) {
+	var f portal.GetListRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = utils.LimitOfFetchTimeline
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	list, err := pdsAgent.GetList(ctx, f.Uri, f.Cursor, f.Limit)
+	if err != nil {
+		log.Errorf("get list %s failed: %v", f.Uri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, list)
+}
+
+// addListItem adds an actor to a list of the session user
+func (a *apiPds) addListItem(w http.ResponseWriter, r *http.Request) {
+	rkey, ok := recordRkey(w, r)
+	if !ok {
+		return
+	}
+	var f portal.ActorRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	did, err := pdsAgent.ResolveDid(ctx, f.Actor)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	listUri := fmt.Sprintf("at://%s/%s/%s", claims.Did, atlib.CollectionList, rkey)
+	// only an own list can get items, and an actor is added once
+	if _, err = pdsAgent.GetRecord(ctx, listUri); err != nil {
+		if atlib.IsRecordNotFound(err) {
+			utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+			return
+		}
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	itemUri, err := a.findListItem(ctx, &pdsAgent, claims, listUri, did)
+	if err == nil && itemUri == "" {
+		itemUri, err = pdsAgent.AddListItem(ctx, listUri, did)
+		if err == nil {
+			a.saveListItemRef(claims, listUri, did, itemUri)
+		}
+	}
+	if err != nil {
+		log.Errorf("add %s to list %s failed: %v", did, listUri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: itemUri})
+}
+
+func (a *apiPds) removeListItem(w http.ResponseWriter, r *http.Request) {
+	rkey, ok := recordRkey(w, r)
+	if !ok {
+		return
+	}
+	var f portal.ActorQuery
+	err := a.parseQueryAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	did, err := pdsAgent.ResolveDid(ctx, f.Actor)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	listUri := fmt.Sprintf("at://%s/%s/%s", claims.Did, atlib.CollectionList, rkey)
+	itemUri, err := a.findListItem(ctx, &pdsAgent, claims, listUri, did)
+	if err != nil {
+		log.Errorf("find %s in list %s failed: %v", did, listUri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if itemUri == "" {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	// the item is in the list of the session repo, so the agent can delete it
+	if err = pdsAgent.DeleteRecord(ctx, itemUri); err != nil {
+		log.Errorf("remove %s from list %s failed: %v", did, listUri, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if err = a.db.DeleteRecordRef(claims.Id, atlib.CollectionListItem, listItemSubject(listUri, did)); err != nil {
+		log.Warnf("delete list item record ref failed: %v", err)
+	}
+	utils.ResponseOK(w, portal.RecordResponse{Uri: itemUri})
+}
+
+// listItemSubject is the subject of the record ref of the item of the DID in the list
+func listItemSubject(listUri, did string) string {
+	return listUri + "#" + did
+}
+
+// findListItem returns the uri of the item of the DID in the list, or an empty string. The stored
+// record ref is used first, the items added by another client are found in the repo and stored
+func (a *apiPds) findListItem(ctx context.Context, pdsAgent *atlib.BskyAgent, claims *authClaims, listUri, did string) (string, error) {
+	ref, err := a.liveRecordRef(ctx, pdsAgent, claims.Id, atlib.CollectionListItem, listItemSubject(listUri, did))
+	if err != nil {
+		return "", err
+	}
+	if ref != nil {
+		return ref.RecordUri, nil
+	}
+	itemUri, err := pdsAgent.FindListItem(ctx, listUri, did)
+	if err != nil || itemUri == "" {
+		return "", err
+	}
+	a.saveListItemRef(claims, listUri, did, itemUri)
+	return itemUri, nil
+}
+
+func (a *apiPds) saveListItemRef(claims *authClaims, listUri, did, itemUri string) {
+	err := a.db.SaveRecordRef(&storage.RecordRef{
+		UserId:     claims.Id,
+		Collection: atlib.CollectionListItem,
+		Subject:    listItemSubject(listUri, did),
+		Did:        claims.Did,
+		RecordUri:  itemUri,
+	})
+	if err != nil {
+		// the item is still found by reading the list items of the repo
+		log.Warnf("save list item record ref failed: %v", err)
+	}
+}
+
+// reportReasonTypes maps the reason types of a report request to the lexicon reasons
+var reportReasonTypes = map[string]string{
+	"spam":       atlib.ReasonSpam,
+	"violation":  atlib.ReasonViolation,
+	"misleading": atlib.ReasonMisleading,
+	"sexual":     atlib.ReasonSexual,
+	"rude":       atlib.ReasonRude,
+	"other":      atlib.ReasonOther,
+}
+
+// createReport forwards the report of a post or an account to the moderation service
+// of the PDS and keeps it for our admins
+func (a *apiPds) createReport(w http.ResponseWriter, r *http.Request) {
+	var f portal.CreateReportRequest
+	err := a.parseJSONAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	ctx := context.Background()
+	pdsAgent := a.newPdsAgent(ctx, claims)
+	report := storage.Report{
+		UserId:     claims.Id,
+		Did:        claims.Did,
+		ReasonType: f.ReasonType,
+		Reason:     f.Reason,
+	}
+	var reason *string
+	if f.Reason != "" {
+		reason = &f.Reason
+	}
+	reasonType := reportReasonTypes[f.ReasonType]
+	if f.Uri != "" {
+		var record *atproto.RepoStrongRef
+		record, err = pdsAgent.GetRecordRef(ctx, f.Uri)
+		if err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+		var aturi syntax.ATURI
+		aturi, err = syntax.ParseATURI(record.Uri)
+		if err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+		report.SubjectType = storage.ReportSubjectRecord
+		report.SubjectDid = aturi.Authority().String()
+		report.SubjectUri = record.Uri
+		report.SubjectCid = record.Cid
+		report.PdsReportId, err = pdsAgent.ReportRecord(ctx, *record, reasonType, reason)
+	} else {
+		var did string
+		did, err = pdsAgent.ResolveDid(ctx, f.Actor)
+		if err != nil {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+			return
+		}
+		report.SubjectType = storage.ReportSubjectAccount
+		report.SubjectDid = did
+		report.PdsReportId, err = pdsAgent.ReportAccount(ctx, did, reasonType, reason)
+	}
+	if err != nil {
+		log.Errorf("report %s %s failed: %v", report.SubjectType, report.SubjectDid, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if err = a.db.CreateReport(&report); err != nil {
+		// the report is already sent to the moderation service
+		log.Warnf("save report %d failed: %v", report.PdsReportId, err)
+	}
+	utils.ResponseOK(w, report)
 }
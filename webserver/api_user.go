@@ -1,5 +1,379 @@
 package webserver
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"socialat/be/authpb"
+	"socialat/be/storage"
+	"socialat/be/utils"
+	"socialat/be/webserver/portal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
 type apiUser struct {
 	*WebServer
 }
+
+// authServiceUser is a user of the auth microservice. Status is 1 for an active account,
+// like the Active of ChangeUserStatus
+type authServiceUser struct {
+	storage.AuthClaims
+	Status int64 `json:"status"`
+}
+
+func (u authServiceUser) adminUser() portal.AdminUser {
+	return portal.AdminUser{
+		Id:          uint64(u.Id),
+		UserName:    u.Username,
+		Role:        utils.UserRole(u.Role),
+		Active:      u.Status == 1,
+		LastLoginAt: time.Unix(u.LastLogindt, 0),
+		CreatedAt:   time.Unix(u.Createdt, 0),
+	}
+}
+
+func localAdminUser(user *storage.User) portal.AdminUser {
+	return portal.AdminUser{
+		Id:          user.Id,
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Role:        user.Role,
+		Active:      !user.Deactivated,
+		LastLoginAt: user.LastLoginAt,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+// listUsers returns a page of the users with their PDS account
+func (a *apiUser) listUsers(w http.ResponseWriter, r *http.Request) {
+	var f portal.UserFilter
+	err := a.parseQueryAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	f.LoginId = claims.Id
+	var users []portal.AdminUser
+	var total int64
+	if a.service.IsLocalAuth() {
+		users, total, err = a.listLocalUsers(&f)
+	} else {
+		users, total, err = a.listAuthServiceUsers(r, &f)
+	}
+	if err != nil {
+		log.Errorf("list users failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if err = a.joinPdsAccounts(users); err != nil {
+		log.Errorf("join pds accounts of users failed: %v", err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"users": users,
+		"total": total,
+	})
+}
+
+func (a *apiUser) listLocalUsers(f *portal.UserFilter) ([]portal.AdminUser, int64, error) {
+	var localUsers []storage.User
+	if err := a.db.GetList(f, &localUsers); err != nil {
+		return nil, 0, err
+	}
+	total, err := a.db.Count(f, &storage.User{})
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make([]portal.AdminUser, 0, len(localUsers))
+	for i := range localUsers {
+		users = append(users, localAdminUser(&localUsers[i]))
+	}
+	return users, total, nil
+}
+
+// listAuthServiceUsers pages the user list of the auth microservice, which returns all the users
+// so they are filtered and sorted here. The keyword only matches the username as the other
+// fields are not kept there
+func (a *apiUser) listAuthServiceUsers(r *http.Request, f *portal.UserFilter) ([]portal.AdminUser, int64, error) {
+	common := &authpb.CommonRequest{AuthToken: r.Header.Get("Authorization")}
+	res, err := a.service.GetAdminUserListHandler(r.Context(), common)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.Error {
+		return nil, 0, errors.New(res.Msg)
+	}
+	var serviceUsers []authServiceUser
+	if err = utils.JsonStringToObject(res.Data, &serviceUsers); err != nil {
+		return nil, 0, err
+	}
+	// the auth microservice knows the logged in user of the token
+	var userNames map[string]bool
+	if f.ExcludeLogin {
+		res, err = a.service.GetExcludeLoginUserNameListHandler(r.Context(), common)
+		if err != nil {
+			return nil, 0, err
+		}
+		if res.Error {
+			return nil, 0, errors.New(res.Msg)
+		}
+		var names []string
+		if err = utils.JsonStringToObject(res.Data, &names); err != nil {
+			return nil, 0, err
+		}
+		userNames = make(map[string]bool, len(names))
+		for _, name := range names {
+			userNames[name] = true
+		}
+	}
+	keyword := strings.ToLower(f.Keyword)
+	users := make([]portal.AdminUser, 0, len(serviceUsers))
+	for _, serviceUser := range serviceUsers {
+		if userNames != nil && !userNames[serviceUser.Username] {
+			continue
+		}
+		if strings.Contains(strings.ToLower(serviceUser.Username), keyword) {
+			users = append(users, serviceUser.adminUser())
+		}
+	}
+	f.SortUsers(users)
+	start, end := f.Window(len(users))
+	return users[start:end], int64(len(users)), nil
+}
+
+// getUser returns the user with the id of the path
+func (a *apiUser) getUser(w http.ResponseWriter, r *http.Request) {
+	userId, ok := pathUserId(w, r)
+	if !ok {
+		return
+	}
+	user, err := a.getAdminUser(r, userId)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, user)
+}
+
+// searchUser returns the user with the username
+func (a *apiUser) searchUser(w http.ResponseWriter, r *http.Request) {
+	var f portal.SearchUserRequest
+	if err := a.parseQueryAndValidate(r, &f); err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	user, err := a.getAdminUserByUserName(r, f.UserName)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	users := []portal.AdminUser{*user}
+	if err = a.joinPdsAccounts(users); err != nil {
+		log.Errorf("join pds account of %s failed: %v", user.UserName, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, users[0])
+}
+
+func (a *apiUser) activateUser(w http.ResponseWriter, r *http.Request) {
+	a.changeUserActive(w, r, true)
+}
+
+// deactivateUser bans the auth account of the user, the PDS account is moderated with the
+// admin account endpoints
+func (a *apiUser) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	a.changeUserActive(w, r, false)
+}
+
+func (a *apiUser) changeUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	userId, ok := pathUserId(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	if claims.Id == userId {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("unable to change your own status"), utils.ErrorBadRequest), nil)
+		return
+	}
+	if err := a.setUserActive(r, userId, active); err != nil {
+		log.Errorf("change status of user %d failed: %v", userId, err)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	user, err := a.getAdminUser(r, userId)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, user)
+}
+
+// getAdminUser returns the user with its PDS account
+func (a *apiUser) getAdminUser(r *http.Request, userId uint64) (*portal.AdminUser, error) {
+	var user portal.AdminUser
+	if a.service.IsLocalAuth() {
+		localUser, err := a.db.GetUserById(userId)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, utils.NotFoundError
+			}
+			return nil, err
+		}
+		user = localAdminUser(localUser)
+	} else {
+		res, err := a.service.GetAdminUserInfoHandler(r.Context(), &authpb.WithUserIdRequest{
+			Common: &authpb.CommonRequest{AuthToken: r.Header.Get("Authorization")},
+			UserId: int64(userId),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if res.Error {
+			return nil, errors.New(res.Msg)
+		}
+		var serviceUser authServiceUser
+		if err = utils.JsonStringToObject(res.Data, &serviceUser); err != nil {
+			return nil, err
+		}
+		user = serviceUser.adminUser()
+	}
+	users := []portal.AdminUser{user}
+	if err := a.joinPdsAccounts(users); err != nil {
+		log.Errorf("join pds account of user %d failed: %v", userId, err)
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// joinPdsAccounts sets the PDS account of the users, with its state on the PDS
+func (a *apiUser) joinPdsAccounts(users []portal.AdminUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+	handles := make([]string, 0, len(users))
+	for _, user := range users {
+		handles = append(handles, utils.GetHandleFromUsername(a.conf.PdsServer, user.UserName))
+	}
+	pdsUsers, err := a.db.GetPdsUsersByHandles(handles)
+	if err != nil {
+		return err
+	}
+	if len(pdsUsers) == 0 {
+		return nil
+	}
+	accounts := make(map[string]*portal.AdminAccount, len(pdsUsers))
+	dids := make([]string, 0, len(pdsUsers))
+	for _, pdsUser := range pdsUsers {
+		accounts[pdsUser.Handle] = &portal.AdminAccount{PdsUser: pdsUser}
+		dids = append(dids, pdsUser.Did)
+	}
+	ctx := context.Background()
+	adminAgent := a.newAdminAgent(ctx)
+	infos, err := adminAgent.GetAccountInfos(ctx, dids)
+	if err != nil {
+		return err
+	}
+	views := make(map[string]*atproto.AdminDefs_AccountView, len(infos))
+	for _, info := range infos {
+		views[info.Did] = info
+	}
+	for i, handle := range handles {
+		if account, ok := accounts[handle]; ok {
+			account.Pds = views[account.Did]
+			users[i].Account = account
+		}
+	}
+	return nil
+}
+
+// getAdminUserByUserName returns the user with the username, without its PDS account
+func (s *WebServer) getAdminUserByUserName(r *http.Request, userName string) (*portal.AdminUser, error) {
+	if s.service.IsLocalAuth() {
+		localUser, err := s.db.GetUserByUserName(userName)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, utils.NotFoundError
+			}
+			return nil, err
+		}
+		user := localAdminUser(localUser)
+		return &user, nil
+	}
+	res, err := s.service.GetUserInfoByUsernameHandler(r.Context(), &authpb.WithUsernameRequest{
+		Common:   &authpb.CommonRequest{AuthToken: r.Header.Get("Authorization")},
+		Username: userName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error {
+		return nil, errors.New(res.Msg)
+	}
+	var serviceUser authServiceUser
+	if err = utils.JsonStringToObject(res.Data, &serviceUser); err != nil {
+		return nil, err
+	}
+	user := serviceUser.adminUser()
+	return &user, nil
+}
+
+// setUserActive activates or deactivates the auth account of the user, on the local user table
+// or on the auth microservice. A deactivated user loses its PDS session
+func (s *WebServer) setUserActive(r *http.Request, userId uint64, active bool) error {
+	if s.service.IsLocalAuth() {
+		user, err := s.db.GetUserById(userId)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return utils.NotFoundError
+			}
+			return err
+		}
+		user.Deactivated = !active
+		if err = s.db.UpdateUser(user); err != nil {
+			return err
+		}
+	} else {
+		var status int64
+		if active {
+			status = 1
+		}
+		res, err := s.service.ChangeUserStatusHandler(r.Context(), &authpb.ChangeUserStatusRequest{
+			Common: &authpb.CommonRequest{AuthToken: r.Header.Get("Authorization")},
+			UserId: int64(userId),
+			Active: status,
+		})
+		if err != nil {
+			return err
+		}
+		if res.Error {
+			return errors.New(res.Msg)
+		}
+	}
+	if active {
+		return nil
+	}
+	// the sockets are only authenticated on connect, the notifier stops polling on disconnect
+	s.service.DisconnectUser(userId)
+	return s.db.DeletePdsSession(userId)
+}
+
+func pathUserId(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	userId, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return 0, false
+	}
+	return userId, true
+}
@@ -0,0 +1,84 @@
+package webserver
+
+import (
+	"context"
+	"socialat/be/firehose"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// firehoseWakeDelay lets the appview index a record of the stream before the activity of the
+// users it concerns is pushed, the PDS streams the commits before they are indexed
+const firehoseWakeDelay = 3 * time.Second
+
+// registerFirehoseHandlers pushes the activity of the connected users as soon as a record
+// concerning them is streamed, instead of on the next poll
+func (s *WebServer) registerFirehoseHandlers() {
+	s.firehose.OnPost(func(ctx context.Context, evt *firehose.PostEvent) error {
+		if evt.Action != firehose.ActionCreate || evt.Post == nil {
+			return nil
+		}
+		// the replies and the mentions notify the authors of the parent and of the root,
+		// and the mentioned users
+		if reply := evt.Post.Reply; reply != nil {
+			if reply.Parent != nil {
+				s.wakeRecordAuthor(reply.Parent.Uri)
+			}
+			if reply.Root != nil {
+				s.wakeRecordAuthor(reply.Root.Uri)
+			}
+		}
+		for _, facet := range evt.Post.Facets {
+			for _, feature := range facet.Features {
+				if feature.RichtextFacet_Mention != nil {
+					s.wakeActivity(feature.RichtextFacet_Mention.Did)
+				}
+			}
+		}
+		return nil
+	})
+	s.firehose.OnLike(func(ctx context.Context, evt *firehose.LikeEvent) error {
+		if evt.Action == firehose.ActionCreate && evt.Like != nil && evt.Like.Subject != nil {
+			s.wakeRecordAuthor(evt.Like.Subject.Uri)
+		}
+		return nil
+	})
+	s.firehose.OnFollow(func(ctx context.Context, evt *firehose.FollowEvent) error {
+		if evt.Action == firehose.ActionCreate && evt.Follow != nil {
+			s.wakeActivity(evt.Follow.Subject)
+		}
+		return nil
+	})
+	// a profile changed by another client is reloaded by the connected sockets of its user
+	s.firehose.OnProfile(func(ctx context.Context, evt *firehose.ProfileEvent) error {
+		if userId, ok := s.notifier.userByDid(evt.Did); ok {
+			s.service.EmitToUser(userId, "profile:update", Map{
+				"did": evt.Did,
+			})
+		}
+		return nil
+	})
+}
+
+// wakeRecordAuthor wakes the activity of the author of the record of the at:// uri
+func (s *WebServer) wakeRecordAuthor(uri string) {
+	aturi, err := syntax.ParseATURI(uri)
+	if err != nil {
+		log.Debugf("firehose skips the invalid record uri %s: %v", uri, err)
+		return
+	}
+	s.wakeActivity(aturi.Authority().String())
+}
+
+// wakeActivity pushes the activity of the connected user with the PDS account of the DID,
+// it does nothing when the user is not connected
+func (s *WebServer) wakeActivity(did string) {
+	userId, ok := s.notifier.userByDid(did)
+	if !ok {
+		return
+	}
+	time.AfterFunc(firehoseWakeDelay, func() {
+		s.pushActivity(userId)
+	})
+}
@@ -0,0 +1,120 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"socialat/be/atlib"
+	"socialat/be/imaging"
+	"socialat/be/storage"
+	"socialat/be/utils"
+	"time"
+
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+)
+
+// linkCardCacheTTL is how long the metadata of a link is reused before the page is fetched again
+const linkCardCacheTTL = 24 * time.Hour
+
+// unfurlLink builds the external embed of a link. The preview image is uploaded to the repo of
+// the poster once per linkCardCacheTTL, the card is kept without thumbnail when the image can not be used
+func (s *WebServer) unfurlLink(ctx context.Context, pdsAgent *atlib.BskyAgent, link string) (*atlib.Link, error) {
+	card, err := s.getLinkCard(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	linkUrl, err := url.Parse(card.Url)
+	if err != nil {
+		return nil, err
+	}
+	result := &atlib.Link{
+		Title:       card.Title,
+		Uri:         *linkUrl,
+		Description: card.Description,
+	}
+	if card.ImageUrl == "" {
+		return result, nil
+	}
+	thumb, err := s.getLinkThumb(ctx, pdsAgent, card)
+	if err != nil {
+		log.Warnf("upload link card image %s failed: %v", card.ImageUrl, err)
+		return result, nil
+	}
+	result.Thumb = *thumb
+	return result, nil
+}
+
+// getLinkCard returns the cached metadata of the link, or fetches and caches it
+func (s *WebServer) getLinkCard(ctx context.Context, link string) (*storage.LinkCard, error) {
+	card, err := s.db.GetLinkCard(link)
+	if err == nil && time.Since(card.UpdatedAt) < linkCardCacheTTL {
+		return card, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warnf("get link card from cache failed: %v", err)
+	}
+	metadata, err := s.service.FetchLinkMetadata(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	card = &storage.LinkCard{
+		Url:         metadata.Url,
+		Title:       metadata.Title,
+		Description: metadata.Description,
+		ImageUrl:    metadata.ImageUrl,
+	}
+	if err := s.db.SaveLinkCard(card); err != nil {
+		log.Warnf("save link card to cache failed: %v", err)
+	}
+	return card, nil
+}
+
+// getLinkThumb returns the thumbnail of the card already uploaded to the repo of the poster,
+// or uploads and caches it
+func (s *WebServer) getLinkThumb(ctx context.Context, pdsAgent *atlib.BskyAgent, card *storage.LinkCard) (*lexutil.LexBlob, error) {
+	cached, err := s.db.GetLinkThumb(card.Url, pdsAgent.Did())
+	if err == nil && cached.ImageUrl == card.ImageUrl && time.Since(cached.CreatedAt) < linkCardCacheTTL {
+		ref, err := cid.Decode(cached.Cid)
+		if err == nil {
+			return &lexutil.LexBlob{
+				Ref:      lexutil.LexLink(ref),
+				MimeType: cached.MimeType,
+				Size:     cached.Size,
+			}, nil
+		}
+		log.Warnf("cached link thumb %s has an invalid cid: %v", cached.Cid, err)
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warnf("get link thumb from cache failed: %v", err)
+	}
+	thumb, err := s.uploadLinkImage(ctx, pdsAgent, card.ImageUrl)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.SaveLinkThumb(&storage.LinkThumb{
+		Url:      card.Url,
+		Did:      pdsAgent.Did(),
+		ImageUrl: card.ImageUrl,
+		Cid:      thumb.Ref.String(),
+		MimeType: thumb.MimeType,
+		Size:     thumb.Size,
+	})
+	if err != nil {
+		log.Warnf("save link thumb to cache failed: %v", err)
+	}
+	return thumb, nil
+}
+
+func (s *WebServer) uploadLinkImage(ctx context.Context, pdsAgent *atlib.BskyAgent, imageUrl string) (*lexutil.LexBlob, error) {
+	data, err := s.service.FetchLinkImage(ctx, imageUrl, utils.MaxImageUploadSize)
+	if err != nil {
+		return nil, err
+	}
+	processed, err := imaging.Process(data, utils.MaxImageBlobSize)
+	if err != nil {
+		return nil, err
+	}
+	return pdsAgent.UploadBlob(ctx, bytes.NewReader(processed.Data), processed.MimeType)
+}
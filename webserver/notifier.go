@@ -0,0 +1,193 @@
+package webserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+)
+
+const (
+	defaultNotificationPollSeconds = 30
+	// notificationPushLimit is the max number of notifications pushed by poll
+	notificationPushLimit = 25
+)
+
+// notifier tracks the users connected to the socket server and the newest activity already
+// pushed to them
+type notifier struct {
+	mu sync.Mutex
+	// connections counts the open sockets of each user
+	connections map[uint64]int
+	// dids are the connected users by the DID of their PDS account, for the firehose events
+	dids  map[string]uint64
+	marks map[uint64]activityMark
+	// pushing are the users with a push in progress, from the poll or from the firehose
+	pushing map[uint64]bool
+}
+
+type activityMark struct {
+	// initialized is false until the first poll, which only records the current activity
+	initialized    bool
+	notificationAt string
+	timelineUri    string
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		connections: make(map[uint64]int),
+		dids:        make(map[string]uint64),
+		marks:       make(map[uint64]activityMark),
+		pushing:     make(map[uint64]bool),
+	}
+}
+
+// connect adds a socket of the user, did is empty when the user has no PDS session
+func (n *notifier) connect(userId uint64, did string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.connections[userId]++
+	if did != "" {
+		n.dids[did] = userId
+	}
+}
+
+func (n *notifier) disconnect(userId uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.connections[userId]--
+	if n.connections[userId] <= 0 {
+		delete(n.connections, userId)
+		delete(n.marks, userId)
+		for did, id := range n.dids {
+			if id == userId {
+				delete(n.dids, did)
+			}
+		}
+	}
+}
+
+// userByDid returns the connected user with the PDS account of the DID
+func (n *notifier) userByDid(did string) (uint64, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	userId, ok := n.dids[did]
+	return userId, ok
+}
+
+// startPush returns false when a push of the user is already in progress, else endPush
+// must be called when it is done
+func (n *notifier) startPush(userId uint64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pushing[userId] {
+		return false
+	}
+	n.pushing[userId] = true
+	return true
+}
+
+func (n *notifier) endPush(userId uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.pushing, userId)
+}
+
+func (n *notifier) users() []uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	users := make([]uint64, 0, len(n.connections))
+	for userId := range n.connections {
+		users = append(users, userId)
+	}
+	return users
+}
+
+func (n *notifier) mark(userId uint64) activityMark {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.marks[userId]
+}
+
+func (n *notifier) setMark(userId uint64, mark activityMark) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// the user may have disconnected during the poll
+	if _, connected := n.connections[userId]; connected {
+		n.marks[userId] = mark
+	}
+}
+
+// pollActivity checks the PDS of the connected users on every interval and pushes the
+// "notification" and "timeline:new" events to their room
+func (s *WebServer) pollActivity() {
+	seconds := s.conf.NotificationPollSeconds
+	if seconds <= 0 {
+		seconds = defaultNotificationPollSeconds
+	}
+	ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, userId := range s.notifier.users() {
+			s.pushActivity(userId)
+		}
+	}
+}
+
+func (s *WebServer) pushActivity(userId uint64) {
+	// the marks are read and written back, two pushes at once would emit the same activity
+	if !s.notifier.startPush(userId) {
+		return
+	}
+	defer s.notifier.endPush(userId)
+	session, err := s.db.GetPdsSessionByUserId(userId)
+	if err != nil {
+		log.Debugf("no pds session to poll for user %d: %v", userId, err)
+		return
+	}
+	ctx := context.Background()
+	pdsAgent := s.newPdsAgent(ctx, &authClaims{
+		Id:         userId,
+		AccessJwt:  session.AccessJwt,
+		RefreshJwt: session.RefreshJwt,
+		Handle:     session.Handle,
+		Did:        session.Did,
+	})
+	mark := s.notifier.mark(userId)
+
+	notifications, err := pdsAgent.ListNotifications(ctx, "", notificationPushLimit, nil)
+	if err != nil {
+		log.Warnf("poll notifications of user %d failed: %v", userId, err)
+	} else {
+		// the notifications are sorted from the newest
+		var fresh []*appbsky.NotificationListNotifications_Notification
+		for _, notification := range notifications.Notifications {
+			if notification.IndexedAt <= mark.notificationAt {
+				break
+			}
+			fresh = append(fresh, notification)
+		}
+		if len(fresh) > 0 {
+			if mark.initialized {
+				s.service.EmitToUser(userId, "notification", fresh)
+			}
+			mark.notificationAt = fresh[0].IndexedAt
+		}
+	}
+
+	timeline, err := pdsAgent.GetTimeline(ctx, "", 1)
+	if err != nil {
+		log.Warnf("poll timeline of user %d failed: %v", userId, err)
+	} else if len(timeline.Feed) > 0 && timeline.Feed[0].Post != nil {
+		uri := timeline.Feed[0].Post.Uri
+		if mark.initialized && uri != mark.timelineUri {
+			s.service.EmitToUser(userId, "timeline:new", Map{
+				"uri": uri,
+			})
+		}
+		mark.timelineUri = uri
+	}
+	mark.initialized = true
+	s.notifier.setMark(userId, mark)
+}
@@ -0,0 +1,118 @@
+package portal
+
+import (
+	"socialat/be/storage"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"gorm.io/gorm"
+)
+
+// ReportFilter is a page of the reports sent by our users, the newest first by default
+type ReportFilter struct {
+	storage.Sort
+	ReasonType  string `schema:"reasonType" validate:"omitempty,oneof=spam violation misleading sexual rude other"`
+	SubjectType string `schema:"subjectType" validate:"omitempty,oneof=account record"`
+	SubjectDid  string `schema:"subjectDid"`
+	UserId      uint64 `schema:"userId"`
+}
+
+func (f *ReportFilter) Sortable() map[string]bool {
+	return map[string]bool{
+		"id":        true,
+		"createdAt": true,
+	}
+}
+
+func (f *ReportFilter) BindQuery(db *gorm.DB) *gorm.DB {
+	if f.Order == "" {
+		f.Order = "createdAt desc"
+	}
+	return f.Sort.BindQuery(f.BindCount(db))
+}
+
+func (f *ReportFilter) BindFirst(db *gorm.DB) *gorm.DB {
+	return f.BindCount(db)
+}
+
+func (f *ReportFilter) BindCount(db *gorm.DB) *gorm.DB {
+	if f.ReasonType != "" {
+		db = db.Where("reason_type = ?", f.ReasonType)
+	}
+	if f.SubjectType != "" {
+		db = db.Where("subject_type = ?", f.SubjectType)
+	}
+	if f.SubjectDid != "" {
+		db = db.Where("subject_did = ?", f.SubjectDid)
+	}
+	if f.UserId != 0 {
+		db = db.Where("user_id = ?", f.UserId)
+	}
+	return db
+}
+
+// PdsUserFilter is a page of the PDS accounts of our users, the newest first by default
+type PdsUserFilter struct {
+	storage.Sort
+	// Handle matches a part of the handle
+	Handle string `schema:"handle" validate:"omitempty,max=253"`
+}
+
+func (f *PdsUserFilter) Sortable() map[string]bool {
+	return map[string]bool{
+		"id":        true,
+		"handle":    true,
+		"createdAt": true,
+	}
+}
+
+func (f *PdsUserFilter) BindQuery(db *gorm.DB) *gorm.DB {
+	if f.Order == "" {
+		f.Order = "createdAt desc"
+	}
+	return f.Sort.BindQuery(f.BindCount(db))
+}
+
+func (f *PdsUserFilter) BindFirst(db *gorm.DB) *gorm.DB {
+	return f.BindCount(db)
+}
+
+func (f *PdsUserFilter) BindCount(db *gorm.DB) *gorm.DB {
+	if f.Handle != "" {
+		db = db.Where("handle ILIKE ?", containsPattern(f.Handle))
+	}
+	return db
+}
+
+// AdminAccount is a PDS account of our users with its state on the PDS
+type AdminAccount struct {
+	storage.PdsUser
+	// Pds is nil when the PDS does not know the account anymore
+	Pds *atproto.AdminDefs_AccountView `json:"pds"`
+}
+
+// UpdateAccountStatusRequest applies or reverts the moderation of an account, a missing
+// attribute is left as it is. The auth account is deactivated while one of them is applied
+type UpdateAccountStatusRequest struct {
+	// Takedown removes the account and its content from the network
+	Takedown *bool `json:"takedown"`
+	// Suspend deactivates the account on the PDS, its repo is kept until it is activated back
+	Suspend *bool `json:"suspend"`
+	// Ref is an optional reference of the moderation action, like a report id
+	Ref string `json:"ref" validate:"omitempty,max=128"`
+}
+
+type DisableInviteCodesRequest struct {
+	Codes []string `json:"codes" validate:"max=100,dive,required"`
+	// Accounts are the DIDs of the accounts whose invite codes are all disabled
+	Accounts []string `json:"accounts" validate:"max=100,dive,required"`
+}
+
+type UpdateAccountEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// containsPattern is the ILIKE pattern matching the text anywhere, with its wildcards escaped
+func containsPattern(text string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+}
@@ -1,6 +1,226 @@
 package portal
 
+import (
+	"time"
+
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+// GetTimelineRequest is a page of the timeline, as for PageRequest the cursor comes from the previous page
 type GetTimelineRequest struct {
-	Cursor string `validate:"omitempty,cursor"`
-	Limit  int64  `validate:"omitempty,limit"`
+	Cursor string `schema:"cursor" validate:"omitempty,cursor"`
+	Limit  int64  `schema:"limit" validate:"omitempty,limit"`
+}
+
+// PdsAccount is the public part of the PDS session. The tokens stay on the server
+type PdsAccount struct {
+	Handle string `json:"handle"`
+	Did    string `json:"did"`
+}
+
+type CreatePostRequest struct {
+	Text   string      `json:"text" validate:"required_without_all=Images QuoteUri"`
+	Facets []PostFacet `json:"facets" validate:"omitempty,dive"`
+	Link   *PostLink   `json:"link" validate:"omitempty,excluded_with=Images"`
+	Images []PostImage `json:"images" validate:"omitempty,max=4,dive"`
+	// DisableLinkCard skips the preview card built from the first link of the text
+	DisableLinkCard bool `json:"disableLinkCard"`
+	// ReplyTo is the AT-URI of the post answered by this post
+	ReplyTo string `json:"replyTo" validate:"omitempty,startswith=at://"`
+	// QuoteUri is the AT-URI of the quoted record, it can be combined with a link or images
+	QuoteUri string `json:"quoteUri" validate:"omitempty,startswith=at://"`
+}
+
+type PostFacet struct {
+	Type  string `json:"type" validate:"required,oneof=link mention tag"`
+	Value string `json:"value" validate:"required"`
+	Text  string `json:"text" validate:"required"`
+}
+
+type PostLink struct {
+	Uri         string           `json:"uri" validate:"required,url"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Thumb       *lexutil.LexBlob `json:"thumb"`
+}
+
+// PostImage is an image blob uploaded to the PDS before creating the post
+type PostImage struct {
+	Alt         string          `json:"alt"`
+	Image       lexutil.LexBlob `json:"image"`
+	AspectRatio *AspectRatio    `json:"aspectRatio"`
+}
+
+type AspectRatio struct {
+	Width  int64 `json:"width" validate:"gt=0"`
+	Height int64 `json:"height" validate:"gt=0"`
+}
+
+type UploadBlobResponse struct {
+	Blob        *lexutil.LexBlob `json:"blob"`
+	AspectRatio *AspectRatio     `json:"aspectRatio,omitempty"`
+}
+
+type CreatePostResponse struct {
+	Uri string `json:"uri"`
+	Cid string `json:"cid"`
+}
+
+// CreateThreadRequest is a long text published as a thread of posts
+type CreateThreadRequest struct {
+	Text string `json:"text" validate:"required"`
+	// Numbering ends every post of the thread with "i/n"
+	Numbering bool `json:"numbering"`
+	// ReplyTo is the AT-URI of the post answered by the first post of the thread
+	ReplyTo string `json:"replyTo" validate:"omitempty,startswith=at://"`
+}
+
+type CreateThreadResponse struct {
+	Posts []CreatePostResponse `json:"posts"`
+}
+
+// SubjectRequest is the post liked or reposted. The cid is resolved from the uri when it is not set
+type SubjectRequest struct {
+	Uri string `json:"uri" validate:"required,startswith=at://"`
+	Cid string `json:"cid"`
+}
+
+// SubjectQuery is the post of an undo operation, in the query string
+type SubjectQuery struct {
+	Uri string `schema:"uri" validate:"required,startswith=at://"`
+}
+
+// RecordResponse is the record created or deleted by an operation
+type RecordResponse struct {
+	Uri string `json:"uri"`
+}
+
+// ActorRequest is the actor followed, blocked, muted or added to a list, by handle or DID
+type ActorRequest struct {
+	Actor string `json:"actor" validate:"required"`
+}
+
+// ActorQuery is the actor of an undo operation, in the query string
+type ActorQuery struct {
+	Actor string `schema:"actor" validate:"required"`
+}
+
+// GetGraphRequest is a page of the followers, follows or lists of an actor, the session user by default
+type GetGraphRequest struct {
+	Actor  string `schema:"actor"`
+	Cursor string `schema:"cursor" validate:"omitempty,cursor"`
+	Limit  int64  `schema:"limit" validate:"omitempty,limit"`
+}
+
+// UpdateProfileRequest changes the profile of the session user, the nil fields are kept.
+// The avatar and banner are blobs uploaded with POST /api/pds/blobs
+type UpdateProfileRequest struct {
+	DisplayName  *string          `json:"displayName" validate:"omitempty,max=64"`
+	Description  *string          `json:"description" validate:"omitempty,max=256"`
+	Avatar       *lexutil.LexBlob `json:"avatar"`
+	Banner       *lexutil.LexBlob `json:"banner"`
+	RemoveAvatar bool             `json:"removeAvatar" validate:"excluded_with=Avatar"`
+	RemoveBanner bool             `json:"removeBanner" validate:"excluded_with=Banner"`
+}
+
+// ListNotificationsRequest is a page of notifications, filtered by the reason query parameters
+type ListNotificationsRequest struct {
+	Cursor  string   `schema:"cursor" validate:"omitempty,cursor"`
+	Limit   int64    `schema:"limit" validate:"omitempty,limit"`
+	Reasons []string `schema:"reason" validate:"omitempty,dive,oneof=like repost follow mention reply quote"`
+}
+
+// UpdateSeenRequest marks the notifications as read up to SeenAt, now by default
+type UpdateSeenRequest struct {
+	SeenAt *time.Time `json:"seenAt"`
+}
+
+type UnreadCountResponse struct {
+	Count int64 `json:"count"`
+}
+
+// GetAuthorFeedRequest is a page of the feed of an actor, the session user by default
+type GetAuthorFeedRequest struct {
+	Actor       string `schema:"actor"`
+	Filter      string `schema:"filter" validate:"omitempty,oneof=posts_with_replies posts_no_replies posts_with_media posts_and_author_threads"`
+	IncludePins bool   `schema:"includePins"`
+	Cursor      string `schema:"cursor" validate:"omitempty,cursor"`
+	Limit       int64  `schema:"limit" validate:"omitempty,limit"`
+}
+
+// GetPostThreadRequest is a post with its replies and parents. The nil depth and parent height
+// take the lexicon defaults
+type GetPostThreadRequest struct {
+	Uri          string `schema:"uri" validate:"required,startswith=at://"`
+	Depth        *int64 `schema:"depth" validate:"omitempty,min=0,max=1000"`
+	ParentHeight *int64 `schema:"parentHeight" validate:"omitempty,min=0,max=1000"`
+}
+
+// GetPostsRequest hydrates the posts of the uri query parameters
+type GetPostsRequest struct {
+	Uris []string `schema:"uri" validate:"required,min=1,max=25,dive,startswith=at://"`
+}
+
+// SearchActorsRequest searches the actors by handle and display name. Typeahead is the prefix
+// search of the mention autocomplete, it ignores the cursor
+type SearchActorsRequest struct {
+	Query     string `schema:"q" validate:"required,max=256"`
+	Typeahead bool   `schema:"typeahead"`
+	Cursor    string `schema:"cursor" validate:"omitempty,cursor"`
+	Limit     int64  `schema:"limit" validate:"omitempty,limit"`
+}
+
+// SearchPostsRequest searches the posts. Since and until are a datetime or a YYYY-MM-DD date,
+// author and mentions a handle or a DID, and the tags are repeated tag parameters without the #
+type SearchPostsRequest struct {
+	Query    string   `schema:"q" validate:"required,max=512"`
+	Sort     string   `schema:"sort" validate:"omitempty,oneof=top latest"`
+	Since    string   `schema:"since" validate:"omitempty,max=64"`
+	Until    string   `schema:"until" validate:"omitempty,max=64"`
+	Author   string   `schema:"author" validate:"omitempty,max=256"`
+	Mentions string   `schema:"mentions" validate:"omitempty,max=256"`
+	Lang     string   `schema:"lang" validate:"omitempty,max=16"`
+	Tags     []string `schema:"tag" validate:"omitempty,max=10,dive,required,max=64"`
+	Cursor   string   `schema:"cursor" validate:"omitempty,cursor"`
+	Limit    int64    `schema:"limit" validate:"omitempty,limit"`
+}
+
+// PageRequest is a page of a list of the session user. The cursor is the one returned with the
+// previous page, the paged outputs pass the cursor of the next (older) page through as is
+type PageRequest struct {
+	Cursor string `schema:"cursor" validate:"omitempty,cursor"`
+	Limit  int64  `schema:"limit" validate:"omitempty,limit"`
+}
+
+// ThreadRequest is the root post of a muted thread
+type ThreadRequest struct {
+	Uri string `json:"uri" validate:"required,startswith=at://"`
+}
+
+// CreateListRequest creates a moderation list, or a curation list with the curatelist purpose
+type CreateListRequest struct {
+	Name        string  `json:"name" validate:"required,max=64"`
+	Purpose     string  `json:"purpose" validate:"omitempty,oneof=modlist curatelist"`
+	Description *string `json:"description" validate:"omitempty,max=300"`
+}
+
+// UpdateListRequest changes a list of the session user, the nil fields are kept
+type UpdateListRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=64"`
+	Description *string `json:"description" validate:"omitempty,max=300"`
+}
+
+// GetListRequest is a list with a page of its items
+type GetListRequest struct {
+	Uri    string `schema:"uri" validate:"required,startswith=at://"`
+	Cursor string `schema:"cursor" validate:"omitempty,cursor"`
+	Limit  int64  `schema:"limit" validate:"omitempty,limit"`
+}
+
+// CreateReportRequest reports a post by its uri, or an account by handle or DID
+type CreateReportRequest struct {
+	Uri        string `json:"uri" validate:"omitempty,startswith=at://,excluded_with=Actor"`
+	Actor      string `json:"actor" validate:"required_without=Uri"`
+	ReasonType string `json:"reasonType" validate:"required,oneof=spam violation misleading sexual rude other"`
+	Reason     string `json:"reason" validate:"omitempty,max=2000"`
 }
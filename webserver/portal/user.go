@@ -1,14 +1,19 @@
 package portal
 
 import (
+	"cmp"
+	"slices"
+	"socialat/be/storage"
 	"socialat/be/utils"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type RegisterForm struct {
 	UserName    string `validate:"required,alphanum,gte=4,lte=32"`
-	DisplayName string
+	DisplayName string `validate:"omitempty,max=64"`
 	Password    string `validate:"required"`
 	Email       string `validate:"omitempty,email"`
 }
@@ -58,3 +63,97 @@ func (a UserWithList) BindCount(db *gorm.DB) *gorm.DB {
 func (a UserWithList) Sortable() map[string]bool {
 	return map[string]bool{}
 }
+
+// UserFilter is a page of the users, the newest first by default.
+// Keyword matches a part of the username, display name or email
+type UserFilter struct {
+	storage.Sort
+	Keyword string `schema:"keyword" validate:"omitempty,max=64"`
+	// ExcludeLogin leaves the logged in user out of the list
+	ExcludeLogin bool `schema:"excludeLogin"`
+	// LoginId is the id of the logged in user, set by the handler
+	LoginId uint64 `schema:"-"`
+}
+
+func (f *UserFilter) Sortable() map[string]bool {
+	return map[string]bool{
+		"id":          true,
+		"userName":    true,
+		"createdAt":   true,
+		"lastLoginAt": true,
+	}
+}
+
+func (f *UserFilter) BindQuery(db *gorm.DB) *gorm.DB {
+	if f.Order == "" {
+		f.Order = "createdAt desc"
+	}
+	return f.Sort.BindQuery(f.BindCount(db))
+}
+
+func (f *UserFilter) BindFirst(db *gorm.DB) *gorm.DB {
+	return f.BindCount(db)
+}
+
+func (f *UserFilter) BindCount(db *gorm.DB) *gorm.DB {
+	if f.Keyword != "" {
+		pattern := containsPattern(f.Keyword)
+		db = db.Where("user_name ILIKE ? OR display_name ILIKE ? OR email ILIKE ?", pattern, pattern, pattern)
+	}
+	if f.ExcludeLogin {
+		db = db.Where("id <> ?", f.LoginId)
+	}
+	return db
+}
+
+// SortUsers sorts the users of a list which is not read from the database, by the order of
+// the filter which is checked against Sortable
+func (f *UserFilter) SortUsers(users []AdminUser) {
+	order := strings.TrimSpace(f.Order)
+	if order == "" {
+		order = "createdAt desc"
+	}
+	fields := strings.Split(order, ",")
+	slices.SortStableFunc(users, func(a, b AdminUser) int {
+		for _, field := range fields {
+			name, direction, _ := strings.Cut(field, " ")
+			var result int
+			switch name {
+			case "id":
+				result = cmp.Compare(a.Id, b.Id)
+			case "userName":
+				result = strings.Compare(a.UserName, b.UserName)
+			case "createdAt":
+				result = a.CreatedAt.Compare(b.CreatedAt)
+			case "lastLoginAt":
+				result = a.LastLoginAt.Compare(b.LastLoginAt)
+			}
+			if direction == "desc" {
+				result = -result
+			}
+			if result != 0 {
+				return result
+			}
+		}
+		return 0
+	})
+}
+
+type SearchUserRequest struct {
+	UserName string `schema:"userName" validate:"required,alphanum,lte=32"`
+}
+
+// AdminUser is the auth account of a user, from the local user table or the auth microservice,
+// with its PDS account
+type AdminUser struct {
+	Id          uint64         `json:"id"`
+	UserName    string         `json:"userName"`
+	DisplayName string         `json:"displayName"`
+	Email       string         `json:"email"`
+	Role        utils.UserRole `json:"role"`
+	Active      bool           `json:"active"`
+	LastLoginAt time.Time      `json:"lastLoginAt"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	// Account is nil when the user has no PDS account
+	Account *AdminAccount `json:"account"`
+}
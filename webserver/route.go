@@ -12,7 +12,7 @@ func (s *WebServer) Route() {
 	s.mux.Use(middleware.Recoverer, cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "PdsJwt", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -44,6 +44,63 @@ func (s *WebServer) Route() {
 			var pdsRouter = apiPds{WebServer: s}
 			r.Get("/get-timeline", pdsRouter.getPdsTimeline)
 			r.Get("/get-pds-session", pdsRouter.getPdsSession)
+			r.Get("/author-feed", pdsRouter.getAuthorFeed)
+			r.Get("/post-thread", pdsRouter.getPostThread)
+			r.Get("/posts", pdsRouter.getPosts)
+			r.Post("/posts", pdsRouter.createPost)
+			r.Put("/posts/{rkey}", pdsRouter.editPost)
+			r.Delete("/posts/{rkey}", pdsRouter.deletePost)
+			r.Post("/threads", pdsRouter.createThread)
+			r.Post("/blobs", pdsRouter.uploadBlob)
+			r.Post("/likes", pdsRouter.like)
+			r.Delete("/likes", pdsRouter.unlike)
+			r.Post("/reposts", pdsRouter.repost)
+			r.Delete("/reposts", pdsRouter.unrepost)
+			r.Post("/follows", pdsRouter.follow)
+			r.Delete("/follows", pdsRouter.unfollow)
+			r.Get("/follows", pdsRouter.getFollows)
+			r.Get("/followers", pdsRouter.getFollowers)
+			r.Post("/blocks", pdsRouter.block)
+			r.Delete("/blocks", pdsRouter.unblock)
+			r.Get("/blocks", pdsRouter.getBlocks)
+			r.Post("/mutes", pdsRouter.muteActor)
+			r.Delete("/mutes", pdsRouter.unmuteActor)
+			r.Get("/mutes", pdsRouter.getMutes)
+			r.Post("/thread-mutes", pdsRouter.muteThread)
+			r.Delete("/thread-mutes", pdsRouter.unmuteThread)
+			r.Post("/lists", pdsRouter.createList)
+			r.Get("/lists", pdsRouter.getLists)
+			r.Get("/list", pdsRouter.getList)
+			r.Put("/lists/{rkey}", pdsRouter.updateList)
+			r.Delete("/lists/{rkey}", pdsRouter.deleteList)
+			r.Post("/lists/{rkey}/items", pdsRouter.addListItem)
+			r.Delete("/lists/{rkey}/items", pdsRouter.removeListItem)
+			r.Get("/profile/{actor}", pdsRouter.getProfile)
+			r.Put("/profile", pdsRouter.updateProfile)
+			r.Get("/search/actors", pdsRouter.searchActors)
+			r.Get("/search/posts", pdsRouter.searchPosts)
+			r.Post("/reports", pdsRouter.createReport)
+			r.Get("/notifications", pdsRouter.listNotifications)
+			r.Get("/notifications/unread-count", pdsRouter.getUnreadCount)
+			r.Post("/notifications/seen", pdsRouter.updateSeen)
+		})
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(s.loggedInMiddleware, s.adminMiddleware)
+			var adminRouter = apiAdmin{WebServer: s}
+			r.Get("/reports", adminRouter.listReports)
+			r.Get("/accounts", adminRouter.listAccounts)
+			r.Get("/accounts/{did}", adminRouter.getAccount)
+			r.Put("/accounts/{did}/status", adminRouter.updateAccountStatus)
+			r.Put("/accounts/{did}/email", adminRouter.updateAccountEmail)
+			r.Post("/invite-codes/disable", adminRouter.disableInviteCodes)
+			r.Route("/users", func(r chi.Router) {
+				var userRouter = apiUser{WebServer: s}
+				r.Get("/", userRouter.listUsers)
+				r.Get("/search", userRouter.searchUser)
+				r.Get("/{id}", userRouter.getUser)
+				r.Put("/{id}/activate", userRouter.activateUser)
+				r.Put("/{id}/deactivate", userRouter.deactivateUser)
+			})
 		})
 	})
 }
@@ -37,6 +37,12 @@ func NewService(conf Config, db *gorm.DB, socket *socketio.Server) *Service {
 	}
 }
 
+// IsLocalAuth reports whether users are authenticated with the local username/password table
+// instead of the external auth microservice
+func (s *Service) IsLocalAuth() bool {
+	return s.Conf.AuthType != int(storage.AuthMicroservicePasskey)
+}
+
 func InitAuthClient(authUrl string) *authpb.AuthServiceClient {
 	log.Infof("API Gateway :  InitAuthClient")
 	//	using WithInsecure() because no SSL running
@@ -229,6 +235,18 @@ func (s *Service) GetAdminUserListHandler(ctx context.Context, req *authpb.Commo
 	return res, nil
 }
 
+func (s *Service) GetAdminUserInfoHandler(ctx context.Context, req *authpb.WithUserIdRequest) (*authpb.ResponseData, error) {
+	err := s.CheckAndInitAuthClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := (*s.AuthClient).GetAdminUserInfo(ctx, req)
+	if err != nil {
+		return res, utils.HandlerRPCError(err)
+	}
+	return res, nil
+}
+
 func (s *Service) GetUserInfoByUsernameHandler(ctx context.Context, req *authpb.WithUsernameRequest) (*authpb.ResponseData, error) {
 	err := s.CheckAndInitAuthClient()
 	if err != nil {
@@ -241,6 +259,18 @@ func (s *Service) GetUserInfoByUsernameHandler(ctx context.Context, req *authpb.
 	return res, nil
 }
 
+func (s *Service) ChangeUserStatusHandler(ctx context.Context, req *authpb.ChangeUserStatusRequest) (*authpb.ResponseData, error) {
+	err := s.CheckAndInitAuthClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := (*s.AuthClient).ChangeUserStatus(ctx, req)
+	if err != nil {
+		return res, utils.HandlerRPCError(err)
+	}
+	return res, nil
+}
+
 func (s *Service) GetExcludeLoginUserNameListHandler(ctx context.Context, req *authpb.CommonRequest) (*authpb.ResponseData, error) {
 	err := s.CheckAndInitAuthClient()
 	if err != nil {
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	linkCardTimeout = 10 * time.Second
+	// maxLinkPageSize is the part of the page read to find the metadata, it is in the head
+	maxLinkPageSize = 1 << 20
+	maxTitleLength  = 300
+	maxDescLength   = 1000
+	linkCardAgent   = "Mozilla/5.0 (compatible; SocialATBot/1.0)"
+)
+
+var errPrivateAddress = errors.New("link points to a private network address")
+
+var (
+	// cgnatNetwork is the shared address space of carrier grade NAT, not covered by IsPrivate
+	cgnatNetwork = mustParseCIDR("100.64.0.0/10")
+	// nat64Network embeds an IPv4 address in its last 4 bytes
+	nat64Network = mustParseCIDR("64:ff9b::/96")
+	// localNat64Network is the NAT64 prefix of a local network
+	localNat64Network = mustParseCIDR("64:ff9b:1::/48")
+)
+
+// LinkMetadata is the preview of an external link read from its OpenGraph, twitter card
+// or HTML metadata
+type LinkMetadata struct {
+	Url         string
+	Title       string
+	Description string
+	ImageUrl    string
+}
+
+// linkCardClient fetches user supplied urls, so it refuses to connect to the
+// loopback, private and link local addresses of our own network
+var linkCardClient = &http.Client{
+	Timeout: linkCardTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: linkCardTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !isPublicAddress(net.ParseIP(host)) {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: linkCardTimeout,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
+
+// isPublicAddress tells if the ip can be fetched, the IPv4 addresses mapped to IPv6 or
+// translated by NAT64 are checked as the IPv4 address they hold
+func isPublicAddress(ip net.IP) bool {
+	if ip == nil || localNat64Network.Contains(ip) {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if nat64Network.Contains(ip) {
+		ip = ip[12:16]
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || cgnatNetwork.Contains(ip))
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// FetchLinkMetadata downloads the page of the link and reads its preview metadata
+func (s *Service) FetchLinkMetadata(ctx context.Context, link string) (*LinkMetadata, error) {
+	resp, err := fetchLink(ctx, link, "text/html")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" {
+		return nil, fmt.Errorf("link is not a html page: %s", contentType)
+	}
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxLinkPageSize), contentType)
+	if err != nil {
+		return nil, err
+	}
+	meta := parseLinkMetadata(body)
+	meta.Url = link
+	if meta.Title == "" {
+		return nil, fmt.Errorf("link has no title")
+	}
+	if meta.ImageUrl != "" {
+		// the image url can be relative to the final page url after redirects
+		imageUrl, err := resp.Request.URL.Parse(meta.ImageUrl)
+		if err != nil || (imageUrl.Scheme != "http" && imageUrl.Scheme != "https") {
+			meta.ImageUrl = ""
+		} else {
+			meta.ImageUrl = imageUrl.String()
+		}
+	}
+	return meta, nil
+}
+
+// FetchLinkImage downloads the preview image of a link, up to maxSize bytes
+func (s *Service) FetchLinkImage(ctx context.Context, imageUrl string, maxSize int64) ([]byte, error) {
+	resp, err := fetchLink(ctx, imageUrl, "image/*")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("link image is too large: %d bytes", resp.ContentLength)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("link image is larger than %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+func fetchLink(ctx context.Context, link, accept string) (*http.Response, error) {
+	linkUrl, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if linkUrl.Scheme != "http" && linkUrl.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported link scheme: %s", linkUrl.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, linkUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", linkCardAgent)
+	resp, err := linkCardClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch link failed: status: %v", resp.Status)
+	}
+	return resp, nil
+}
+
+// parseLinkMetadata reads the head of the page. OpenGraph tags are preferred over
+// twitter card tags, which are preferred over the title and description tags
+func parseLinkMetadata(body io.Reader) *LinkMetadata {
+	values := make(map[string]string)
+	var title strings.Builder
+	inTitle := false
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return newLinkMetadata(values, title.String())
+		case html.TextToken:
+			if inTitle {
+				title.Write(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return newLinkMetadata(values, title.String())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+			case "body":
+				return newLinkMetadata(values, title.String())
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var attrKey, attrValue []byte
+					attrKey, attrValue, hasAttr = tokenizer.TagAttr()
+					switch string(attrKey) {
+					case "property", "name":
+						key = strings.ToLower(string(attrValue))
+					case "content":
+						content = string(attrValue)
+					}
+				}
+				if _, exist := values[key]; key != "" && !exist {
+					values[key] = strings.TrimSpace(content)
+				}
+			}
+		}
+	}
+}
+
+func newLinkMetadata(values map[string]string, title string) *LinkMetadata {
+	return &LinkMetadata{
+		Title:       truncate(firstValue(values["og:title"], values["twitter:title"], strings.TrimSpace(title)), maxTitleLength),
+		Description: truncate(firstValue(values["og:description"], values["twitter:description"], values["description"]), maxDescLength),
+		ImageUrl:    firstValue(values["og:image"], values["og:image:url"], values["twitter:image"], values["twitter:image:src"]),
+	}
+}
+
+func firstValue(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func truncate(text string, maxLength int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= maxLength {
+		return string(runes)
+	}
+	return string(runes[:maxLength-1]) + "…"
+}
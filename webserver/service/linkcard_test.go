@@ -0,0 +1,42 @@
+package service
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::10.0.0.1", false},
+		{"64:ff9b::93.184.216.34", true},
+		{"64:ff9b:1::93.184.216.34", false},
+	}
+	for _, test := range tests {
+		if got := isPublicAddress(net.ParseIP(test.ip)); got != test.public {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", test.ip, got, test.public)
+		}
+	}
+	if isPublicAddress(nil) {
+		t.Errorf("an address which can not be parsed is public")
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"fmt"
+
+	socketio "github.com/googollee/go-socket.io"
+)
+
+// UserRoom is the socket room joined by every authenticated connection of the user
+func UserRoom(userId uint64) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+// EmitToUser sends the event to all the open sockets of the user
+func (s *Service) EmitToUser(userId uint64, event string, data interface{}) bool {
+	return s.socket.BroadcastToRoom("/", UserRoom(userId), event, data)
+}
+
+// DisconnectUser closes all the open sockets of the user. The sockets are collected first,
+// as closing a socket leaves its rooms, which waits for the room lock held by ForEach
+func (s *Service) DisconnectUser(userId uint64) {
+	var conns []socketio.Conn
+	s.socket.ForEach("/", UserRoom(userId), func(conn socketio.Conn) {
+		conns = append(conns, conn)
+	})
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
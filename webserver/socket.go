@@ -1,41 +1,75 @@
 package webserver
 
 import (
+	"context"
 	"net/http"
+	"socialat/be/utils"
+	"socialat/be/webserver/service"
+	"strings"
 
 	socketio "github.com/googollee/go-socket.io"
 )
 
-func NewSocketServer() *socketio.Server {
+// newSocketServer accepts the connections with the same bearer token as the api, sent in the
+// Authorization header or, for the browsers that can not set it, in the token query parameter.
+// Every connection joins the room of its user
+func (s *WebServer) newSocketServer() *socketio.Server {
 	server := socketio.NewServer(nil)
-	server.OnConnect("/", func(s socketio.Conn) error {
-		s.SetContext("")
+	server.OnConnect("/", func(conn socketio.Conn) error {
+		claims, isLogin := s.authenticate(context.Background(), socketBearer(conn))
+		if !isLogin {
+			return utils.InvalidCredential
+		}
+		conn.SetContext(claims)
+		conn.Join(service.UserRoom(claims.Id))
+		s.notifier.connect(claims.Id, claims.Did)
 		return nil
 	})
 
-	server.OnEvent("/", "join", func(s socketio.Conn, msg string) {
-		s.Join(msg)
+	server.OnEvent("/", "join", func(conn socketio.Conn, msg string) {
+		// the user rooms receive private events, they are only joined on connect
+		if strings.HasPrefix(msg, "user:") {
+			return
+		}
+		conn.Join(msg)
 	})
 
-	server.OnEvent("/", "left", func(s socketio.Conn, msg string) {
-		s.Leave(msg)
+	server.OnEvent("/", "left", func(conn socketio.Conn, msg string) {
+		if strings.HasPrefix(msg, "user:") {
+			return
+		}
+		conn.Leave(msg)
 	})
 
-	server.OnError("/", func(s socketio.Conn, e error) {
-		s.Close()
+	server.OnError("/", func(conn socketio.Conn, e error) {
+		conn.Close()
 	})
 
-	server.OnDisconnect("/", func(s socketio.Conn, msg string) {
-		s.Close()
+	server.OnDisconnect("/", func(conn socketio.Conn, msg string) {
+		if claims, ok := conn.Context().(*authClaims); ok {
+			s.notifier.disconnect(claims.Id)
+		}
+		conn.Close()
 	})
 	return server
 }
 
+func socketBearer(conn socketio.Conn) string {
+	if bearer := conn.RemoteHeader().Get("Authorization"); bearer != "" {
+		return bearer
+	}
+	connUrl := conn.URL()
+	if token := connUrl.Query().Get("token"); token != "" {
+		return "Bearer " + token
+	}
+	return ""
+}
+
 func (s *WebServer) handleSocket() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, PdsJwt, Content-Type, Content-Length, X-CSRF-Token, Token, session, Origin, Host, Connection, Accept-Encoding, Accept-Language, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, X-CSRF-Token, Token, session, Origin, Host, Connection, Accept-Encoding, Accept-Language, X-Requested-With")
 		r.Header.Del("Origin")
 		s.socket.ServeHTTP(w, r)
 	}
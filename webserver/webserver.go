@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"socialat/be/atlib"
 	"socialat/be/authpb"
 	"socialat/be/email"
+	"socialat/be/firehose"
 	"socialat/be/storage"
 	"socialat/be/utils"
+	"socialat/be/webserver/portal"
 	"socialat/be/webserver/service"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/bluesky-social/indigo/xrpc"
 	socketio "github.com/googollee/go-socket.io"
@@ -19,17 +24,24 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 type Config struct {
-	Port              int            `yaml:"port"`
-	HmacSecretKey     string         `yaml:"hmacSecretKey"`
-	AesSecretKey      string         `yaml:"aesSecretKey"`
-	AliveSessionHours int            `yaml:"aliveSessionHours"`
-	ClientAddr        string         `yaml:"clientAddr"`
-	PdsAdminToken     string         `yaml:"pdsAdminToken"`
-	PdsServer         string         `yaml:"pdsServer"`
-	Service           service.Config `yaml:"service"`
+	Port                 int            `yaml:"port"`
+	HmacSecretKey        string         `yaml:"hmacSecretKey"`
+	AesSecretKey         string         `yaml:"aesSecretKey"`
+	AesSecretKeyVersion  int            `yaml:"aesSecretKeyVersion"`
+	AesRetiredSecretKeys map[int]string `yaml:"aesRetiredSecretKeys"`
+	AliveSessionHours    int            `yaml:"aliveSessionHours"`
+	ClientAddr           string         `yaml:"clientAddr"`
+	PdsAdminToken        string         `yaml:"pdsAdminToken"`
+	PdsServer            string         `yaml:"pdsServer"`
+	// NotificationPollSeconds is the interval of the PDS polls pushing new activity to the sockets
+	NotificationPollSeconds int            `yaml:"notificationPollSeconds"`
+	Service                 service.Config `yaml:"service"`
+	// Firehose subscribes to the repo event stream of the PDS
+	Firehose firehose.Config `yaml:"firehose"`
 }
 
 type WebServer struct {
@@ -40,6 +52,11 @@ type WebServer struct {
 	mail      *email.MailClient
 	service   *service.Service
 	socket    *socketio.Server
+	notifier  *notifier
+	// firehose is nil when the consumer is not enabled
+	firehose *firehose.Consumer
+	// sessionLocks are the refresh locks of the PDS sessions by user id
+	sessionLocks sync.Map
 }
 
 type key string
@@ -64,24 +81,60 @@ func NewWebServer(c Config, db storage.Storage, mailClient *email.MailClient) (*
 	if c.PdsServer == "" {
 		return nil, fmt.Errorf("please set up pdsServer")
 	}
-	socket := NewSocketServer()
-	sv := service.NewService(c.Service, db.GetDB(), socket)
-
-	return &WebServer{
+	webServer := &WebServer{
 		mux:       chi.NewRouter(),
 		conf:      &c,
 		db:        db,
-		validator: validator.New(),
+		validator: newValidator(),
 		mail:      mailClient,
-		service:   sv,
-		socket:    socket,
-	}, nil
+		notifier:  newNotifier(),
+	}
+	// the socket server authenticates the connections with the web server
+	webServer.socket = webServer.newSocketServer()
+	webServer.service = service.NewService(c.Service, db.GetDB(), webServer.socket)
+	if c.Firehose.Enabled {
+		host := c.Firehose.Host
+		if host == "" {
+			host = c.PdsServer
+		}
+		webServer.firehose = firehose.NewConsumer(host, db)
+		webServer.registerFirehoseHandlers()
+	}
+	return webServer, nil
+}
+
+// newValidator registers the custom tags used by the portal requests
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	// cursor is the opaque pagination cursor returned by the PDS
+	validate.RegisterValidation("cursor", func(fl validator.FieldLevel) bool {
+		cursor := fl.Field().String()
+		if len(cursor) > utils.MaxCursorLength {
+			return false
+		}
+		for _, c := range cursor {
+			if !unicode.IsPrint(c) {
+				return false
+			}
+		}
+		return true
+	})
+	// limit is the page size of a PDS list request
+	validate.RegisterValidation("limit", func(fl validator.FieldLevel) bool {
+		limit := fl.Field().Int()
+		return limit >= 1 && limit <= utils.MaxFetchLimit
+	})
+	return validate
 }
 
 func (s *WebServer) Run() error {
 	s.Route()
 	log.Info("socialat is running on port:", s.conf.Port)
 	go s.socket.Serve()
+	go s.pollActivity()
+	if s.firehose != nil {
+		go s.firehose.Run(context.Background())
+	}
 	var server = http.Server{
 		Addr:              fmt.Sprintf(":%d", s.conf.Port),
 		Handler:           s.mux,
@@ -112,11 +165,16 @@ func (s *WebServer) parseJSON(r *http.Request, data interface{}) error {
 }
 
 // parseQueryAndValidate parse the url query to a filter and validate the filter
-// at the moment, only Sort filter is in need of validation
+// with its validate tags and, for a storage.Filter, its sort field
 func (s *WebServer) parseQueryAndValidate(r *http.Request, data interface{}) error {
 	// for POST request, we use json decoder. So here we just handle the case of GET request
-	err := schema.NewDecoder().Decode(data, r.URL.Query())
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	err := decoder.Decode(data, r.URL.Query())
 	if err != nil {
+		return utils.NewError(err, utils.ErrorBadRequest)
+	}
+	if err = s.validator.Struct(data); err != nil {
 		return err
 	}
 	var f, ok = data.(storage.Filter)
@@ -136,40 +194,60 @@ func (s *WebServer) parseJSONAndValidate(r *http.Request, data interface{}) erro
 
 func (s *WebServer) loggedInMiddleware(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		var bearer = r.Header.Get("Authorization")
-		exClaims, isLogin := s.checkMicroServiceLoginMiddleware(r, bearer)
+		localAuthClaims, isLogin := s.authenticate(r.Context(), r.Header.Get("Authorization"))
 		if !isLogin {
 			utils.Response(w, http.StatusBadRequest, utils.InvalidCredential, nil)
 			return
 		}
-		localAuthClaims := authClaims{
+		ctx := context.WithValue(r.Context(), authClaimsCtxKey, localAuthClaims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// authenticate verifies the bearer token with the local auth or the auth microservice,
+// then loads the pds session of the user kept on server side
+func (s *WebServer) authenticate(ctx context.Context, bearer string) (*authClaims, bool) {
+	var localAuthClaims authClaims
+	if s.service.IsLocalAuth() {
+		claims, isLogin := s.parseBearer(bearer)
+		if !isLogin {
+			return nil, false
+		}
+		// the token of a user deactivated by an admin stays valid until it expires
+		user, err := s.db.GetUserById(claims.Id)
+		if err != nil || user.Deactivated {
+			return nil, false
+		}
+		localAuthClaims = *claims
+		// the role comes from the user row, so a demoted admin loses it before the token expires
+		localAuthClaims.UserRole = user.Role
+	} else {
+		exClaims, isLogin := s.checkMicroServiceLoginMiddleware(ctx, bearer)
+		if !isLogin {
+			return nil, false
+		}
+		localAuthClaims = authClaims{
 			Id:       uint64(exClaims.Id),
 			UserRole: utils.UserRole(exClaims.Role),
 			Expire:   exClaims.Expire,
 			UserName: exClaims.Username,
 		}
-		var pdsJwtStr = r.Header.Get("PdsJwt")
-		if !utils.IsEmpty(pdsJwtStr) {
-			var jwtObj xrpc.AuthInfo
-			err := utils.JsonStringToObject(pdsJwtStr, &jwtObj)
-			if err != nil {
-				log.Errorf("Logged in but unable to connect to Pds server")
-			} else {
-				localAuthClaims.AccessJwt = jwtObj.AccessJwt
-				localAuthClaims.RefreshJwt = jwtObj.RefreshJwt
-				localAuthClaims.Handle = jwtObj.Handle
-				localAuthClaims.Did = jwtObj.Did
-			}
-		}
-
-		ctx := context.WithValue(r.Context(), authClaimsCtxKey, &localAuthClaims)
-		next.ServeHTTP(w, r.WithContext(ctx))
 	}
-	return http.HandlerFunc(fn)
+	pdsSession, err := s.db.GetPdsSessionByUserId(localAuthClaims.Id)
+	if err == nil {
+		localAuthClaims.AccessJwt = pdsSession.AccessJwt
+		localAuthClaims.RefreshJwt = pdsSession.RefreshJwt
+		localAuthClaims.Handle = pdsSession.Handle
+		localAuthClaims.Did = pdsSession.Did
+	} else if err != gorm.ErrRecordNotFound {
+		log.Errorf("Logged in but unable to load pds session. %v", err)
+	}
+	return &localAuthClaims, true
 }
 
-func (s *WebServer) checkMicroServiceLoginMiddleware(r *http.Request, bearer string) (*storage.AuthClaims, bool) {
-	response, err := s.service.GetAuthClaimsLogin(r.Context(), &authpb.CommonRequest{
+func (s *WebServer) checkMicroServiceLoginMiddleware(ctx context.Context, bearer string) (*storage.AuthClaims, bool) {
+	response, err := s.service.GetAuthClaimsLogin(ctx, &authpb.CommonRequest{
 		AuthToken: bearer,
 	})
 
@@ -200,13 +278,15 @@ func (s *WebServer) adminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
-func (s *WebServer) parseBearer(r *http.Request) (*authClaims, bool) {
-	var bearer = r.Header.Get("Authorization")
+func (s *WebServer) parseBearer(bearer string) (*authClaims, bool) {
 	// Should be a bearer token
 	if len(bearer) > 6 && strings.ToUpper(bearer[0:7]) == "BEARER " {
 		var tokenStr = bearer[7:]
 		var claim authClaims
 		_, err := jwt.ParseWithClaims(tokenStr, &claim, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
 			return []byte(s.conf.HmacSecretKey), nil
 		})
 		if err != nil {
@@ -217,6 +297,73 @@ func (s *WebServer) parseBearer(r *http.Request) (*authClaims, bool) {
 	return nil, false
 }
 
+// createToken signs the auth claims with hmacSecretKey for the local auth mode
+func (s *WebServer) createToken(claims authClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.conf.HmacSecretKey))
+}
+
+// savePdsSession stores the pds tokens of the user on server side and returns the public account info
+func (s *WebServer) savePdsSession(userId uint64, authInfo *xrpc.AuthInfo) (*portal.PdsAccount, error) {
+	err := s.db.SavePdsSession(&storage.PdsSession{
+		UserId:     userId,
+		Did:        authInfo.Did,
+		Handle:     authInfo.Handle,
+		AccessJwt:  authInfo.AccessJwt,
+		RefreshJwt: authInfo.RefreshJwt,
+	})
+	if err != nil {
+		log.Errorf("save pds session failed. %v", err)
+		return nil, err
+	}
+	return &portal.PdsAccount{
+		Handle: authInfo.Handle,
+		Did:    authInfo.Did,
+	}, nil
+}
+
+// newPdsAgent creates a pds agent authenticated with the server side session of the user.
+// Tokens rotated by an automatic refresh are written back to the session store
+func (s *WebServer) newPdsAgent(ctx context.Context, claims *authClaims) atlib.BskyAgent {
+	agent := atlib.NewBasicAgent(ctx, s.conf.PdsServer)
+	agent.SetClientAuth(claims.AccessJwt, claims.RefreshJwt, claims.Handle, claims.Did)
+	// the requests and the notification poll of a user refresh the same session one at a time,
+	// the session is read again under the lock as it may have been refreshed while waiting
+	agent.SetSessionLockHandler(func() (*xrpc.AuthInfo, func()) {
+		value, _ := s.sessionLocks.LoadOrStore(claims.Id, &sync.Mutex{})
+		lock := value.(*sync.Mutex)
+		lock.Lock()
+		session, err := s.db.GetPdsSessionByUserId(claims.Id)
+		if err != nil {
+			log.Errorf("reload pds session of user %d failed. %v", claims.Id, err)
+			return nil, lock.Unlock
+		}
+		claims.AccessJwt = session.AccessJwt
+		claims.RefreshJwt = session.RefreshJwt
+		return &xrpc.AuthInfo{
+			AccessJwt:  session.AccessJwt,
+			RefreshJwt: session.RefreshJwt,
+			Handle:     session.Handle,
+			Did:        session.Did,
+		}, lock.Unlock
+	})
+	agent.SetSessionRefreshedHandler(func(authInfo *xrpc.AuthInfo) {
+		claims.AccessJwt = authInfo.AccessJwt
+		claims.RefreshJwt = authInfo.RefreshJwt
+		if _, err := s.savePdsSession(claims.Id, authInfo); err != nil {
+			log.Errorf("persist refreshed pds session failed. %v", err)
+		}
+	})
+	return agent
+}
+
+// newAdminAgent creates a pds agent authenticated with the admin token of the PDS
+func (s *WebServer) newAdminAgent(ctx context.Context) atlib.BskyAgent {
+	agent := atlib.NewBasicAgent(ctx, s.conf.PdsServer)
+	agent.SetAdminToken(s.conf.PdsAdminToken)
+	return agent
+}
+
 func (s *WebServer) credentialsInfo(r *http.Request) (*authClaims, bool) {
 	val := r.Context().Value(authClaimsCtxKey)
 	claims, ok := val.(*authClaims)